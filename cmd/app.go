@@ -1,51 +1,148 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/quells/mastobot/internal/app"
 	"github.com/quells/mastobot/internal/oauth2"
 	"github.com/quells/mastobot/internal/toot"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
 var (
 	appName   string
 	userEmail string
-	password  string
+	password  *secretFlags
+	otp       string
+	otpSecret *secretFlags
+
+	importToken        *secretFlags
+	importClientID     string
+	importClientSecret *secretFlags
+	importScopes       string
+
+	verifyExpectAcct string
+	verifyJSON       bool
 
 	tootVisibilityS string
 	tootVisibility  toot.Visibility
 	tootSensitive   bool
 	tootSpoilerText string
+	tootIdempotency string
+	tootScheduleS   string
+	tootScheduledAt time.Time
+	tootLanguage    string
+	tootContentType string
+
+	pollOptions    []string
+	pollExpires    time.Duration
+	pollMultiple   bool
+	pollHideTotals bool
+	pollJSON       bool
+
+	scheduledJSON bool
 
 	maxAge time.Duration
+
+	registerLoopback bool
+	registerForce    bool
+	registerScopes   string
+	tokenScopes      string
+	loginWait        time.Duration
+
+	accountsJSON bool
 )
 
+const userAgent = "mastobot (+https://github.com/quells/mastobot)"
+
+const accountUsage = "Account of the application to act as, which holds its own token (default the application's token)"
+
 func init() {
+	// required by every subcommand except list, checked in appCmd's PersistentPreRunE
 	appCmd.PersistentFlags().StringVar(&instance, "instance", "", "Mastodon (or compatible) instance to interact with")
-	must(appCmd.MarkPersistentFlagRequired("instance"))
-
 	appCmd.PersistentFlags().StringVar(&appName, "name", "", "Name of the application")
-	must(appCmd.MarkPersistentFlagRequired("name"))
+	appCmd.PersistentFlags().StringVar(&account, "account", "", accountUsage)
 
 	appTokenRenewCmd.Flags().StringVarP(&userEmail, "email", "U", "", "Account email")
-	appTokenRenewCmd.Flags().StringVarP(&password, "password", "P", "", "Account password")
+	password = addSecretFlags(appTokenRenewCmd, "password", "Account password", "MASTOBOT_PASSWORD")
+	appTokenRenewCmd.Flags().StringVarP(&password.value, "password", "P", "", "Account password")
+	must(appTokenRenewCmd.Flags().MarkDeprecated("password", "use --password-file, --password-stdin or MASTOBOT_PASSWORD"))
 	must(appTokenRenewCmd.MarkFlagRequired("email"))
-	must(appTokenRenewCmd.MarkFlagRequired("password"))
+	appTokenRenewCmd.Flags().StringVar(&otp, "otp", "", "Two-factor code (default generated from the stored TOTP secret)")
+	appTokenRenewCmd.Flags().StringVar(&tokenScopes, "scopes", "", "Space separated scopes to request (default the scopes the application holds)")
 	appTokenCmd.AddCommand(appTokenRenewCmd)
 
+	appTokenLoginCmd.Flags().StringVar(&tokenScopes, "scopes", "", "Space separated scopes to request (default the scopes the application holds)")
+	appTokenLoginCmd.Flags().DurationVar(&loginWait, "wait", 5*time.Minute, "How long to wait for authorization")
+	appTokenCmd.AddCommand(appTokenLoginCmd)
+
 	appTokenCmd.AddCommand(appTokenRevokeCmd)
 
+	importToken = addSecretFlags(appTokenSetCmd, "token", "Access token", "MASTOBOT_TOKEN")
+	appTokenSetCmd.Flags().StringVar(&importClientID, "client-id", "", "Client ID of the application, if known")
+	importClientSecret = addSecretFlags(appTokenSetCmd, "client-secret", "Client secret", "MASTOBOT_CLIENT_SECRET")
+	appTokenSetCmd.Flags().StringVar(&importScopes, "scopes", "", "Space separated scopes the token was granted, required if the instance does not report them")
+	appTokenCmd.AddCommand(appTokenSetCmd)
+
+	appTokenVerifyCmd.Flags().StringVar(&verifyExpectAcct, "expect-acct", "", "Fail unless the token belongs to this account")
+	appTokenVerifyCmd.Flags().BoolVar(&verifyJSON, "json", false, "Print as JSON")
+	appTokenCmd.AddCommand(appTokenVerifyCmd)
+
+	appRegisterCmd.Flags().BoolVar(&registerLoopback, "loopback", false, "Redirect to a listener on 127.0.0.1 during login instead of displaying a code")
+	appRegisterCmd.Flags().StringVar(&registerScopes, "scopes", "read write", "Space separated scopes the application may request, e.g. \"write:statuses write:media\"")
+	appRegisterCmd.Flags().BoolVar(&registerForce, "force", false, "Register again if the application already exists, replacing its credentials")
 	appCmd.AddCommand(appRegisterCmd)
 	appCmd.AddCommand(appTokenCmd)
 
+	appCmd.AddCommand(appShowCmd)
+	appCmd.AddCommand(appRemoveCmd)
+	appCmd.AddCommand(appListCmd)
+
+	appAccountListCmd.Flags().BoolVar(&accountsJSON, "json", false, "Print as JSON")
+	appAccountCmd.AddCommand(appAccountListCmd)
+	appAccountCmd.AddCommand(appAccountRemoveCmd)
+	appCmd.AddCommand(appAccountCmd)
+
+	otpSecret = addSecretFlags(appOTPSetCmd, "secret", "TOTP secret", "MASTOBOT_OTP_SECRET")
+	appOTPCmd.AddCommand(appOTPSetCmd)
+	appOTPCmd.AddCommand(appOTPClearCmd)
+	appCmd.AddCommand(appOTPCmd)
+
 	appTootCmd.Flags().StringVar(&tootVisibilityS, "visibility", "private", "[private, unlisted, public, direct]")
 	appTootCmd.Flags().BoolVar(&tootSensitive, "sensitive", false, "Mark Toot as containing sensitive material")
 	appTootCmd.Flags().StringVar(&tootSpoilerText, "spoiler", "", "Spoiler text")
+	appTootCmd.Flags().StringVar(&tootIdempotency, "idempotency-key", "", "Post at most once per key within about an hour, e.g. when retried by cron")
+	appTootCmd.Flags().StringVar(&tootLanguage, "language", "", "ISO 639 code of the toot's language (default the application's \"language\" value, if set)")
+	appTootCmd.Flags().StringVar(&tootContentType, "content-type", "", "Format of the toot: text/plain, text/markdown or text/html (Pleroma and Akkoma only)")
+	appTootCmd.Flags().StringVar(&tootScheduleS, "scheduled-at", "", "Have the instance post the toot later, at a time as RFC 3339 or a duration from now, e.g. 2h")
+	appTootCmd.Flags().StringArrayVar(&pollOptions, "poll-option", nil, "Attach a poll with this option, repeated for each option")
+	appTootCmd.Flags().DurationVar(&pollExpires, "poll-expires", 24*time.Hour, "How long the poll is open")
+	appTootCmd.Flags().BoolVar(&pollMultiple, "poll-multiple", false, "Allow choosing more than one poll option")
+	appTootCmd.Flags().BoolVar(&pollHideTotals, "poll-hide-totals", false, "Hide vote counts until the poll ends")
 	appCmd.AddCommand(appTootCmd)
 
+	appPollResultsCmd.Flags().BoolVar(&pollJSON, "json", false, "Print as JSON")
+	appPollCmd.AddCommand(appPollResultsCmd)
+	appCmd.AddCommand(appPollCmd)
+
+	appScheduledListCmd.Flags().BoolVar(&scheduledJSON, "json", false, "Print as JSON")
+	appScheduledCmd.AddCommand(appScheduledListCmd)
+	appScheduledCmd.AddCommand(appScheduledRescheduleCmd)
+	appScheduledCmd.AddCommand(appScheduledCancelCmd)
+	appCmd.AddCommand(appScheduledCmd)
+
 	appExpireCmd.Flags().DurationVar(&maxAge, "max-age", 30*24*time.Hour, "Maximum age")
 	appCmd.AddCommand(appExpireCmd)
 
@@ -58,6 +155,23 @@ var appCmd = &cobra.Command{
 	Long: `Application Helpers
 Register an application with an instance.
 Generate OAuth2 access tokens.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if cmd != appListCmd {
+			var missing []string
+			if instance == "" {
+				missing = append(missing, `"instance"`)
+			}
+			if appName == "" {
+				missing = append(missing, `"name"`)
+			}
+			if len(missing) > 0 {
+				return fmt.Errorf("required flag(s) %s not set", strings.Join(missing, ", "))
+			}
+		}
+
+		rootCmd.PersistentPreRun(cmd, args)
+		return nil
+	},
 }
 
 var appRegisterCmd = &cobra.Command{
@@ -65,7 +179,61 @@ var appRegisterCmd = &cobra.Command{
 	Short: "Register Application",
 	Long:  "Register an application with an instance.",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return oauth2.RegisterApp(cmd.Context(), instance, appName)
+		redirectURI := oauth2.OOB
+		if registerLoopback {
+			redirectURI = oauth2.LoopbackRedirectURI
+		}
+		return oauth2.RegisterApp(cmd.Context(), instance, appName, redirectURI, oauth2.ParseScopes(registerScopes).String(), registerForce)
+	},
+}
+
+var appListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List registered applications",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apps, err := app.List(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "INSTANCE\tNAME\tAPP ID\tTOKEN\tLAST USED")
+		for _, info := range apps {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				info.Instance, info.AppName, info.AppID, yesNo(info.HasToken), formatLastUsed(info.LastUsed))
+		}
+		return w.Flush()
+	},
+}
+
+var appShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show a registered application",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info, err := app.Get(cmd.Context(), instance, appName)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintf(w, "Instance:\t%s\n", info.Instance)
+		_, _ = fmt.Fprintf(w, "Name:\t%s\n", info.AppName)
+		_, _ = fmt.Fprintf(w, "App ID:\t%s\n", info.AppID)
+		_, _ = fmt.Fprintf(w, "Redirect URI:\t%s\n", info.RedirectURI)
+		_, _ = fmt.Fprintf(w, "Scopes:\t%s\n", info.Scopes)
+		_, _ = fmt.Fprintf(w, "Token:\t%s\n", yesNo(info.HasToken))
+		_, _ = fmt.Fprintf(w, "Last used:\t%s\n", formatLastUsed(info.LastUsed))
+		return w.Flush()
+	},
+}
+
+var appRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove a registered application",
+	Long: `Remove a registered application, its accounts and its stored values from the database.
+The access token is not revoked with the instance; use "app token revoke" first.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return app.Remove(cmd.Context(), instance, appName)
 	},
 }
 
@@ -74,18 +242,328 @@ var appTokenCmd = &cobra.Command{
 	Short: "Access Token Helpers",
 	Long: `Access Token Helpers to connect to an instance as a user.
 Renew an access token.
-Revoke an access token.`,
+Log in through a browser.
+Revoke an access token.
+Import an existing access token.
+Verify an access token.`,
 }
 
 var appTokenRenewCmd = &cobra.Command{
 	Use:   "renew",
 	Short: "Renew an access token",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return oauth2.GetAccessToken(cmd.Context(), instance, appName, userEmail, password)
+		pw, err := password.read()
+		if err != nil {
+			return err
+		}
+
+		creds := oauth2.Credentials{
+			Email:    userEmail,
+			Password: pw,
+			OTP:      otp,
+		}
+		if err = oauth2.GetAccessToken(cmd.Context(), instance, appName, creds, tokenScopes); err != nil {
+			return err
+		}
+		return checkAccount(cmd.Context(), appName)
+	},
+}
+
+var appTokenLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Get an access token by logging in through a browser",
+	Long: `Get an access token by logging in through a browser.
+Prints a URL to open in a browser where the account grants access to the application.
+If the application was registered with --loopback, the authorization code is received
+by a temporary listener on 127.0.0.1. Otherwise the code shown by the instance is read
+from stdin.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// waiting for the user would use up the request timeout
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(cmd.Context()), loginWait)
+		defer cancel()
+
+		redirectURI, err := app.GetRedirectURI(ctx, instance, appName)
+		if err != nil {
+			return err
+		}
+		if oauth2.IsLoopback(redirectURI) {
+			err = oauth2.LoopbackLogin(ctx, instance, appName, tokenScopes, func(u string) {
+				_, _ = fmt.Fprintln(os.Stderr, "Open this URL in a browser and authorize the application:")
+				_, _ = fmt.Fprintln(os.Stderr, u)
+			})
+			if err != nil {
+				return err
+			}
+			return checkAccount(ctx, appName)
+		}
+
+		var u string
+		u, err = oauth2.AuthorizeURL(ctx, instance, appName, tokenScopes)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(os.Stderr, "Open this URL in a browser and authorize the application:")
+		_, _ = fmt.Fprintln(os.Stderr, u)
+		_, _ = fmt.Fprint(os.Stderr, "Authorization code: ")
+
+		var code string
+		code, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		code = strings.TrimSpace(code)
+		if code == "" {
+			return fmt.Errorf("no authorization code provided")
+		}
+
+		if err = oauth2.ExchangeCode(ctx, instance, appName, tokenScopes, code); err != nil {
+			return err
+		}
+		return checkAccount(ctx, appName)
+	},
+}
+
+var appTokenRevokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Revoke an access token",
+	Long:  "Revoke the stored access token with the instance and remove it from the database.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return oauth2.RevokeAccessToken(cmd.Context(), instance, appName)
 	},
 }
 
-var appTokenRevokeCmd = &cobra.Command{} // TODO
+var appTokenSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Import an existing access token",
+	Long: `Import an access token created elsewhere, e.g. under Preferences > Development
+in the instance's web interface. The token is verified with the instance before
+it is stored. The application does not need to be registered with mastobot.
+Its scopes are read from the instance (Mastodon 4.3 and later), or else must be
+given with --scopes.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		token, err := importToken.read()
+		if err != nil {
+			return err
+		}
+
+		var clientSecret string
+		if importClientID != "" {
+			clientSecret, err = importClientSecret.read()
+			if err != nil {
+				return err
+			}
+		}
+
+		ctx := cmd.Context()
+		c := &toot.Client{
+			BaseURL:   "https://" + instance,
+			Token:     token,
+			UserAgent: userAgent,
+			Logger:    log.Logger,
+		}
+		var application toot.Application
+		application, err = c.VerifyApplication(ctx)
+		if err != nil {
+			return err
+		}
+
+		acct := app.AccountName(ctx)
+		var verified toot.Account
+		verified, err = c.VerifyCredentials(ctx)
+		var apiErr *toot.Error
+		switch {
+		case err == nil:
+			log.Info().Str("account_id", verified.ID).Msg("verified access token")
+		case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden && acct == "":
+			// only tokens with the profile or read:accounts scope may read the account
+			log.Info().Msg("verified access token with its application")
+		default:
+			return err
+		}
+
+		if acct != "" && !verified.Is(acct, instance) {
+			return fmt.Errorf("token belongs to %q, not account %q", verified.Acct, acct)
+		}
+
+		scopes := oauth2.ParseScopes(strings.Join(application.Scopes, " ")).String()
+		switch {
+		case scopes == "" && importScopes == "":
+			return fmt.Errorf("instance does not report the scopes of the token; pass --scopes")
+		case scopes == "":
+			scopes = oauth2.ParseScopes(importScopes).String()
+		case importScopes != "" && oauth2.ParseScopes(importScopes).String() != scopes:
+			log.Warn().Str("scopes", scopes).Msg("using the scopes reported by the instance instead of --scopes")
+		}
+
+		err = app.ImportAccessToken(ctx, instance, appName, importClientID, clientSecret, token, scopes)
+		if err != nil || acct == "" {
+			return err
+		}
+		return app.SaveAccountInfo(ctx, instance, appName, acct, verified.ID, verified.Username)
+	},
+}
+
+var appTokenVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify an access token",
+	Long: `Verify the access token with the instance and show the account and application
+it belongs to. Exits with an error if the token is invalid, or does not belong to
+the account given with --expect-acct. Tokens without the profile or read:accounts
+scope can only be checked against the application.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		granted, err := oauth2.GrantedScopes(ctx, instance, appName)
+		if err != nil {
+			return err
+		}
+
+		var result struct {
+			Account     *toot.Account    `json:"account,omitempty"`
+			Application toot.Application `json:"application"`
+		}
+
+		c, err := newClient(ctx, appName)
+		if err != nil {
+			return err
+		}
+
+		result.Application, err = c.VerifyApplication(ctx)
+		if err != nil {
+			return err
+		}
+		if len(result.Application.Scopes) == 0 {
+			result.Application.Scopes = granted
+		}
+
+		if granted.Covers("profile") {
+			var account toot.Account
+			account, err = c.VerifyCredentials(ctx)
+			if err != nil {
+				return err
+			}
+			result.Account = &account
+		}
+
+		if verifyJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err = enc.Encode(result); err != nil {
+				return err
+			}
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if a := result.Account; a != nil {
+				_, _ = fmt.Fprintf(w, "Username:\t%s\n", a.Username)
+				_, _ = fmt.Fprintf(w, "Acct:\t%s\n", a.Acct)
+				_, _ = fmt.Fprintf(w, "Account ID:\t%s\n", a.ID)
+				_, _ = fmt.Fprintf(w, "Bot:\t%s\n", yesNo(a.Bot))
+				_, _ = fmt.Fprintf(w, "Followers:\t%d\n", a.FollowersCount)
+			} else {
+				_, _ = fmt.Fprintf(w, "Account:\tunknown (requires profile or read:accounts scope)\n")
+			}
+			_, _ = fmt.Fprintf(w, "App name:\t%s\n", result.Application.Name)
+			_, _ = fmt.Fprintf(w, "Scopes:\t%s\n", strings.Join(result.Application.Scopes, " "))
+			if err = w.Flush(); err != nil {
+				return err
+			}
+		}
+
+		if verifyExpectAcct != "" {
+			if result.Account == nil {
+				return fmt.Errorf("cannot check account without profile or read:accounts scope")
+			}
+			if !result.Account.Is(verifyExpectAcct, instance) {
+				return fmt.Errorf("token belongs to %q, expected %q", result.Account.Acct, verifyExpectAcct)
+			}
+		}
+
+		return nil
+	},
+}
+
+var appAccountCmd = &cobra.Command{
+	Use:   "account",
+	Short: "Account Helpers",
+	Long: `Account Helpers for applications used by several accounts.
+Each account holds its own access token, requested with --account on the token
+commands, and is selected with --account when tooting.
+List the accounts of an application.
+Remove an account.`,
+}
+
+var appAccountListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the accounts of an application",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accounts, err := app.ListAccounts(cmd.Context(), instance, appName)
+		if err != nil {
+			return err
+		}
+
+		if accountsJSON {
+			if accounts == nil {
+				accounts = []app.Account{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(accounts)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ACCOUNT\tACCOUNT ID\tUSERNAME\tSCOPES\tTOKEN\tLAST USED")
+		for _, a := range accounts {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				a.Acct, a.AccountID, a.Username, a.Scopes, yesNo(a.HasToken), formatLastUsed(a.LastUsed))
+		}
+		return w.Flush()
+	},
+}
+
+var appAccountRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove an account of an application",
+	Long: `Remove the account given with --account and its access token from the database.
+The access token is not revoked with the instance; use "app token revoke" first.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		acct := app.AccountName(cmd.Context())
+		if acct == "" {
+			return fmt.Errorf(`required flag(s) "account" not set`)
+		}
+		return app.RemoveAccount(cmd.Context(), instance, appName, acct)
+	},
+}
+
+var appOTPCmd = &cobra.Command{
+	Use:   "otp",
+	Short: "Two-Factor Authentication Helpers",
+	Long: `Two-Factor Authentication Helpers for accounts with TOTP enabled.
+Store the TOTP secret so codes are generated while renewing access tokens.
+Remove the stored TOTP secret.`,
+}
+
+var appOTPSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Store the TOTP secret",
+	Long:  "Store the base32 TOTP secret shown when two-factor authentication was enabled for the account.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		secret, err := otpSecret.read()
+		if err != nil {
+			return err
+		}
+		return oauth2.SetOTPSecret(cmd.Context(), instance, appName, secret)
+	},
+}
+
+var appOTPClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove the stored TOTP secret",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return app.SetOTPSecret(cmd.Context(), instance, appName, "")
+	},
+}
 
 var appTootCmd = &cobra.Command{
 	Use:   "toot",
@@ -98,10 +576,16 @@ var appTootCmd = &cobra.Command{
 		if tootVisibility == toot.VisibilityInvalid {
 			return fmt.Errorf("invalid visibility value")
 		}
+		if tootScheduleS != "" {
+			var err error
+			if tootScheduledAt, err = parseScheduleTime(tootScheduleS, time.Now()); err != nil {
+				return fmt.Errorf("invalid --scheduled-at: %w", err)
+			}
+		}
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		_, err := toot.VerifyCredentials(cmd.Context(), instance, appName)
+		c, err := checkToken(cmd.Context(), appName, "write:statuses")
 		if err != nil {
 			return err
 		}
@@ -111,12 +595,189 @@ var appTootCmd = &cobra.Command{
 			Visibility: tootVisibility,
 			Sensitive:  tootSensitive,
 			Spoiler:    tootSpoilerText,
+			Language:   statusLanguage(cmd.Context(), appName, tootLanguage),
+
+			ContentType: toot.ContentTypeText(tootContentType),
+			ScheduledAt: tootScheduledAt,
+		}
+		if len(pollOptions) > 0 {
+			status.Poll = &toot.Poll{
+				Options:    pollOptions,
+				ExpiresIn:  pollExpires,
+				Multiple:   pollMultiple,
+				HideTotals: pollHideTotals,
+			}
+		}
+		if tootIdempotency != "" {
+			status.IdempotencyKey = toot.IdempotencyKey(appName, tootIdempotency)
+		}
+		if err = status.Validate(instanceLimits(cmd.Context())); err != nil {
+			return err
+		}
+		id, err := c.SubmitStatus(cmd.Context(), status)
+		if errors.Is(err, toot.ErrNotScheduled) {
+			log.Warn().Str("status_id", id).Msg(err.Error())
+			status.ScheduledAt = time.Time{}
+			err = nil
 		}
-		id, err := status.Submit(cmd.Context(), instance, appName)
 		if err != nil {
 			return err
 		}
 		_, _ = fmt.Fprintln(os.Stdout, id)
+		// scheduled statuses are posted by the instance, out of sight of the history
+		if status.ScheduledAt.IsZero() {
+			recordPost(cmd.Context(), cmd, appName, status, id)
+		}
+		return nil
+	},
+}
+
+var appScheduledCmd = &cobra.Command{
+	Use:   "scheduled",
+	Short: "Toots scheduled with --scheduled-at",
+}
+
+var appScheduledListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List toots waiting to be posted",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := checkToken(cmd.Context(), appName, "read:statuses")
+		if err != nil {
+			return err
+		}
+
+		statuses, err := c.ScheduledStatuses(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		if scheduledJSON {
+			if statuses == nil {
+				statuses = []toot.ScheduledStatus{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(statuses)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ID\tSCHEDULED AT\tVISIBILITY\tMEDIA\tPOLL\tTEXT")
+		for _, s := range statuses {
+			p := s.Params
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+				s.ID, s.ScheduledAt.Local().Format(time.RFC3339), p.Visibility, len(p.MediaIDs), yesNo(p.Poll != nil),
+				toot.Truncate(strings.Join(strings.Fields(p.Text), " "), 40))
+		}
+		return w.Flush()
+	},
+}
+
+var appScheduledRescheduleCmd = &cobra.Command{
+	Use:   "reschedule <id> <time>",
+	Short: "Move a scheduled toot to another time",
+	Long: `Move a scheduled toot to another time, as RFC 3339 or a duration from now,
+e.g. 2h.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		at, err := parseScheduleTime(args[1], time.Now())
+		if err != nil {
+			return err
+		}
+		if time.Until(at) < toot.MinScheduleDelay {
+			return fmt.Errorf("toots must be scheduled at least %s ahead", toot.MinScheduleDelay)
+		}
+
+		c, err := checkToken(cmd.Context(), appName, "write:statuses")
+		if err != nil {
+			return err
+		}
+
+		status, err := c.RescheduleStatus(cmd.Context(), args[0], at)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(os.Stdout, "Scheduled %s at %s\n", status.ID, status.ScheduledAt.Local().Format(time.RFC3339))
+		return nil
+	},
+}
+
+var appScheduledCancelCmd = &cobra.Command{
+	Use:   "cancel <id>",
+	Short: "Cancel a scheduled toot",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := checkToken(cmd.Context(), appName, "write:statuses")
+		if err != nil {
+			return err
+		}
+		return c.CancelScheduledStatus(cmd.Context(), args[0])
+	},
+}
+
+// parseScheduleTime as RFC 3339 or a duration after now.
+func parseScheduleTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time or duration", s)
+}
+
+var appPollCmd = &cobra.Command{
+	Use:   "poll",
+	Short: "Polls attached to toots",
+}
+
+var appPollResultsCmd = &cobra.Command{
+	Use:   "results <status-id>",
+	Short: "Print the votes of a poll",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := checkToken(cmd.Context(), appName, "read:statuses")
+		if err != nil {
+			return err
+		}
+
+		poll, err := c.StatusPoll(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+
+		if pollJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(poll)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "OPTION\tVOTES")
+		for _, o := range poll.Options {
+			votes := "hidden"
+			if o.VotesCount != nil {
+				votes = strconv.Itoa(*o.VotesCount)
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\n", o.Title, votes)
+		}
+		if err = w.Flush(); err != nil {
+			return err
+		}
+
+		summary := fmt.Sprintf("\n%d votes", poll.VotesCount)
+		if poll.VotersCount != nil {
+			summary += fmt.Sprintf(" from %d voters", *poll.VotersCount)
+		}
+		switch {
+		case poll.ExpiresAt == nil:
+			summary += ", open"
+		case poll.Expired:
+			summary += ", closed " + poll.ExpiresAt.Local().Format(time.RFC3339)
+		default:
+			summary += ", closes " + poll.ExpiresAt.Local().Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintln(os.Stdout, summary)
 		return nil
 	},
 }
@@ -124,18 +785,48 @@ var appTootCmd = &cobra.Command{
 var appExpireCmd = &cobra.Command{
 	Use:   "expire",
 	Short: "Delete old toots",
-	Long:  "Delete all toots older than a certain age.",
+	Long: `Delete all toots older than a certain age. Instances limit how quickly
+statuses can be deleted, by default 30 every 30 minutes on Mastodon; deletion
+waits for the limit to reset, so raise --timeout for large cleanups.
+
+Requires the read:statuses and write:statuses scopes, and profile to look up
+the account unless its ID was stored when the token for --account was verified.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		accountID, err := toot.VerifyCredentials(cmd.Context(), instance, appName)
+		accountID, err := storedAccountID(cmd.Context(), appName)
+		if err != nil {
+			return err
+		}
+
+		required := []string{"read:statuses", "write:statuses"}
+		if accountID == "" {
+			// the account ID comes from verifying credentials
+			required = append(required, "profile")
+		}
+		_, err = oauth2.RequireScopes(cmd.Context(), instance, appName, required...)
 		if err != nil {
 			return err
 		}
 
+		var c *toot.Client
+		c, err = newClient(cmd.Context(), appName)
+		if err != nil {
+			return err
+		}
+
+		if accountID == "" {
+			var account toot.Account
+			account, err = c.VerifyCredentials(cmd.Context())
+			if err != nil {
+				return err
+			}
+			accountID = account.ID
+		}
+
 		list := toot.ListStatuses{
 			Limit: 40,
 		}
 		for {
-			statuses, err := list.ForAccount(cmd.Context(), instance, appName, accountID)
+			statuses, err := c.AccountStatuses(cmd.Context(), accountID, list)
 			if err != nil {
 				return err
 			}
@@ -150,7 +841,7 @@ var appExpireCmd = &cobra.Command{
 
 				// TODO: check mentions; add option to prevent deletion if mentioned
 
-				err = toot.Delete(cmd.Context(), instance, appName, status.ID)
+				err = c.DeleteStatus(cmd.Context(), status.ID)
 				if err != nil {
 					return err
 				}
@@ -162,3 +853,115 @@ var appExpireCmd = &cobra.Command{
 		return nil
 	},
 }
+
+// newClient with the access token of the application, or of the account
+// selected with --account.
+func newClient(ctx context.Context, appName string) (*toot.Client, error) {
+	c, err := toot.NewClient(ctx, instance, appName)
+	if err != nil {
+		return nil, err
+	}
+	c.UserAgent = userAgent
+	c.Logger = log.Logger
+	return c, nil
+}
+
+// statusLanguage is lang, or else the default language stored for the
+// application in kv, if any.
+func statusLanguage(ctx context.Context, appName, lang string) string {
+	if lang != "" {
+		return lang
+	}
+	lang, err := app.GetValue(ctx, instance, appName, app.LanguageKey)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to read default language")
+	}
+	return lang
+}
+
+// storedAccountID of the account selected with --account, saved once its token
+// was verified. Empty if no account is selected or its ID is not known yet.
+func storedAccountID(ctx context.Context, appName string) (string, error) {
+	acct := app.AccountName(ctx)
+	if acct == "" {
+		return "", nil
+	}
+
+	accounts, err := app.ListAccounts(ctx, instance, appName)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range accounts {
+		if a.Acct == acct {
+			return a.AccountID, nil
+		}
+	}
+	return "", nil
+}
+
+// checkToken fails early if the application's access token is missing any of
+// the required scopes. Tokens which may read the account are also checked
+// against the instance. Returns a client with the token.
+func checkToken(ctx context.Context, appName string, required ...string) (*toot.Client, error) {
+	granted, err := oauth2.RequireScopes(ctx, instance, appName, required...)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newClient(ctx, appName)
+	if err != nil {
+		return nil, err
+	}
+	if !granted.Covers("profile") {
+		return c, nil
+	}
+
+	if _, err = c.VerifyCredentials(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// checkAccount a new token was issued to, if one was selected. The token is
+// removed if it belongs to another account, and kept if it could not be
+// checked. Tokens without the profile or read:accounts scope cannot be checked.
+func checkAccount(ctx context.Context, appName string) error {
+	if app.AccountName(ctx) == "" {
+		return nil
+	}
+
+	granted, err := oauth2.GrantedScopes(ctx, instance, appName)
+	if err != nil {
+		return err
+	}
+	if !granted.Covers("profile") {
+		log.Warn().Msg("cannot check the account of a token without profile or read:accounts scope")
+		return nil
+	}
+
+	var c *toot.Client
+	if c, err = newClient(ctx, appName); err != nil {
+		return err
+	}
+	_, err = c.VerifyCredentials(ctx)
+	if errors.Is(err, toot.ErrWrongAccount) {
+		if cErr := app.ClearAccessToken(ctx, instance, appName); cErr != nil {
+			log.Error().Err(cErr).Msg("failed to remove access token")
+		}
+	}
+	return err
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func formatLastUsed(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format(time.RFC3339)
+}
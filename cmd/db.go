@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/quells/mastobot/internal/crypt"
+	"github.com/quells/mastobot/internal/dbcontext"
+	"github.com/quells/mastobot/internal/dbexport"
+	"github.com/quells/mastobot/internal/dbmigrations"
+	"github.com/quells/mastobot/internal/secret"
+	"github.com/spf13/cobra"
+)
+
+var (
+	newKeyFile string
+
+	exportOutput    string
+	exportNoSecrets bool
+	importConflict  string
+
+	downTo int64
+)
+
+func init() {
+	dbRotateKeyCmd.Flags().StringVar(&newKeyFile, "new-key-file", "", "Read the new key from file (default $MASTOBOT_NEW_KEY)")
+
+	dbExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write to file instead of stdout")
+	dbExportCmd.Flags().BoolVar(&exportNoSecrets, "no-secrets", false, "Leave out client secrets, tokens and TOTP secrets")
+	dbImportCmd.Flags().StringVar(&importConflict, "on-conflict", "skip", "What to do with rows which already exist: skip, overwrite or fail")
+
+	dbDownCmd.Flags().Int64Var(&downTo, "to", 0, "Roll back every migration newer than VERSION instead of only the latest")
+
+	dbCmd.AddCommand(dbStatusCmd)
+	dbCmd.AddCommand(dbUpCmd)
+	dbCmd.AddCommand(dbDownCmd)
+	dbCmd.AddCommand(dbEncryptCmd)
+	dbCmd.AddCommand(dbRotateKeyCmd)
+	dbCmd.AddCommand(dbExportCmd)
+	dbCmd.AddCommand(dbImportCmd)
+	rootCmd.AddCommand(dbCmd)
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the database",
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:         "status",
+	Short:       "Show applied and pending migrations",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{manualMigrations: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dialect := dbcontext.DialectName(cmd.Context())
+		status, version, err := dbmigrations.Status(db, dialect)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "VERSION\tMIGRATION\tSTATUS")
+		pending := 0
+		for _, m := range status {
+			state := "applied"
+			if !m.Applied {
+				state = "pending"
+				pending++
+			}
+			_, _ = fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, state)
+		}
+		if err = w.Flush(); err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintf(os.Stdout, "\nCurrent version %d, %d pending\n", version, pending)
+		if err = dbmigrations.Check(db, dialect); err != nil {
+			_, _ = fmt.Fprintln(os.Stdout, err)
+		}
+		return nil
+	},
+}
+
+var dbUpCmd = &cobra.Command{
+	Use:         "up",
+	Short:       "Apply pending migrations",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{manualMigrations: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dialect := dbcontext.DialectName(cmd.Context())
+		if err := dbmigrations.Apply(db, dialect); err != nil {
+			return err
+		}
+		return printVersion(dialect)
+	},
+}
+
+var dbDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Roll back migrations",
+	Long: `Roll back the latest migration, or every migration newer than --to. Rolling
+back drops tables and columns along with the data in them; consider db export
+first. Commands other than db apply pending migrations again unless run with
+--no-migrate.`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{manualMigrations: "true"},
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		dialect := dbcontext.DialectName(cmd.Context())
+		if cmd.Flags().Changed("to") {
+			if err = dbmigrations.RollbackTo(db, dialect, downTo); err != nil {
+				return err
+			}
+			return printVersion(dialect)
+		}
+
+		if err = dbmigrations.Check(db, dialect); err != nil {
+			return err
+		}
+		var version int64
+		if version, err = dbmigrations.Version(db, dialect); err != nil {
+			return err
+		}
+		if version == 0 {
+			return errors.New("no migrations to roll back")
+		}
+		if err = dbmigrations.Rollback(db, dialect); err != nil {
+			return err
+		}
+		return printVersion(dialect)
+	},
+}
+
+func printVersion(dialect string) error {
+	version, err := dbmigrations.Version(db, dialect)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(os.Stdout, "Database schema at version %d\n", version)
+	return nil
+}
+
+var dbEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt stored secrets",
+	Long: `Encrypt client secrets, access tokens, refresh tokens and TOTP secrets which
+are stored in plaintext with the key from --key-file or MASTOBOT_KEY.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		key := crypt.From(ctx)
+		if key == nil {
+			return fmt.Errorf("no key provided; use --key-file or set MASTOBOT_KEY")
+		}
+
+		n, err := store.Reencrypt(ctx, key, key)
+		if err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintf(os.Stdout, "Encrypted secrets of %d applications and accounts\n", n)
+		return nil
+	},
+}
+
+var dbRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Re-encrypt stored secrets with a new key",
+	Long: `Decrypt stored secrets with the current key from --key-file or MASTOBOT_KEY
+and encrypt them with the new key from --new-key-file or MASTOBOT_NEW_KEY.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		newKey, err := readKey(newKeyFile, "MASTOBOT_NEW_KEY")
+		if err != nil {
+			return err
+		}
+		if newKey == nil {
+			return fmt.Errorf("no new key provided; use --new-key-file or set MASTOBOT_NEW_KEY")
+		}
+
+		ctx := cmd.Context()
+		n, err := store.Reencrypt(ctx, crypt.From(ctx), newKey)
+		if err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintf(os.Stdout, "Re-encrypted secrets of %d applications and accounts\n", n)
+		return nil
+	},
+}
+
+var dbExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the database as JSON",
+	Long: `Export applications, accounts, stored values, cached instance capabilities and
+the post history as JSON, e.g. to move bots to another host with db import.
+Encrypted secrets stay encrypted and can only be imported with the same key.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		w := os.Stdout
+		if exportOutput != "" {
+			// secrets may be in plaintext
+			w, err = os.OpenFile(exportOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if cErr := w.Close(); err == nil {
+					err = cErr
+				}
+			}()
+		}
+
+		return dbexport.Write(cmd.Context(), w, !exportNoSecrets)
+	},
+}
+
+var dbImportCmd = &cobra.Command{
+	Use:   "import [FILE]",
+	Short: "Import a database export",
+	Long: `Merge a JSON export written by db export into the database, reading stdin if no
+file is given. Secrets are encrypted with the key of this database, if any.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conflict, err := dbexport.ParseConflict(importConflict)
+		if err != nil {
+			return err
+		}
+
+		r := os.Stdin
+		if len(args) == 1 && args[0] != "-" {
+			r, err = os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+		}
+
+		counts, err := dbexport.Read(cmd.Context(), r, conflict)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "TABLE\tINSERTED\tOVERWRITTEN\tSKIPPED")
+		for _, c := range counts {
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", c.Table, c.Inserted, c.Overwritten, c.Skipped)
+		}
+		return w.Flush()
+	},
+}
+
+// readKey from file or the environment variable. Returns nil if neither is set.
+func readKey(file, env string) (*crypt.Key, error) {
+	value, err := secret.Source{File: file, Env: env}.Read()
+	if errors.Is(err, secret.ErrNotProvided) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return crypt.ParseKey(value)
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 
@@ -12,6 +14,7 @@ import (
 func init() {
 	goesCmd.PersistentFlags().StringVar(&instance, "instance", "", "Mastodon (or compatible) instance to interact with")
 	must(goesCmd.MarkPersistentFlagRequired("instance"))
+	goesCmd.PersistentFlags().StringVar(&account, "account", "", accountUsage)
 
 	goesCmd.AddCommand(goesWestCmd)
 	rootCmd.AddCommand(goesCmd)
@@ -28,7 +31,7 @@ var goesWestCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		const appName = "GOES-17"
 
-		_, err := toot.VerifyCredentials(cmd.Context(), instance, appName)
+		c, err := checkToken(cmd.Context(), appName, "write:media", "write:statuses")
 		if err != nil {
 			return err
 		}
@@ -46,23 +49,30 @@ var goesWestCmd = &cobra.Command{
 			Description: "Satellite image of the western hemisphere of Earth",
 			Focus:       [2]float64{0.5, 0.5},
 		}
+		if err = upload.Validate(instanceLimits(cmd.Context())); err != nil {
+			return err
+		}
 		var mediaID string
-		mediaID, err = upload.Submit(cmd.Context(), instance, appName)
+		mediaID, err = c.UploadMedia(cmd.Context(), upload)
 		if err != nil {
 			return err
 		}
 		_, _ = fmt.Fprintln(os.Stdout, mediaID)
 
+		imageHash := sha256.Sum256(large)
 		status := toot.Status{
 			MediaIDs:   []string{mediaID},
 			Visibility: toot.VisibilityPublic,
+			// a re-run for the same image posts nothing new
+			IdempotencyKey: toot.IdempotencyKey(appName, hex.EncodeToString(imageHash[:])),
 		}
 		var statusID string
-		statusID, err = status.Submit(cmd.Context(), instance, appName)
+		statusID, err = c.SubmitStatus(cmd.Context(), status)
 		if err != nil {
 			return err
 		}
 		_, _ = fmt.Fprintln(os.Stdout, statusID)
+		recordPost(cmd.Context(), cmd, appName, status, statusID)
 
 		return nil
 	},
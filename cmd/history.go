@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/quells/mastobot/internal/app"
+	"github.com/quells/mastobot/internal/ledger"
+	"github.com/quells/mastobot/internal/toot"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyName  string
+	historySince string
+	historyUntil string
+	historyLimit int
+	historyJSON  bool
+)
+
+func init() {
+	historyCmd.Flags().StringVar(&instance, "instance", "", "Only posts to this instance")
+	historyCmd.Flags().StringVar(&historyName, "name", "", "Only posts by this application")
+	historyCmd.Flags().StringVar(&account, "account", "", "Only posts by this account")
+	historyCmd.Flags().StringVar(&historySince, "since", "", "Only posts at or after this time, as RFC 3339, a date or a duration ago, e.g. 24h")
+	historyCmd.Flags().StringVar(&historyUntil, "until", "", "Only posts before this time, in the same formats as --since")
+	historyCmd.Flags().IntVar(&historyLimit, "limit", 50, "Maximum number of posts, 0 for all")
+	historyCmd.Flags().BoolVar(&historyJSON, "json", false, "Print as JSON")
+	rootCmd.AddCommand(historyCmd)
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List posts made by mastobot",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		q := ledger.Query{
+			Instance: instance,
+			AppName:  historyName,
+			Account:  app.NormalizeAcct(account, instance),
+			Limit:    historyLimit,
+		}
+
+		var err error
+		if q.Since, err = parseHistoryTime(historySince, now); err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+		if q.Until, err = parseHistoryTime(historyUntil, now); err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+
+		posts, err := ledger.List(cmd.Context(), q)
+		if err != nil {
+			return err
+		}
+
+		if historyJSON {
+			if posts == nil {
+				posts = []ledger.Post{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(posts)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "CREATED\tINSTANCE\tNAME\tACCOUNT\tSTATUS ID\tVISIBILITY\tMEDIA\tCOMMAND")
+		for _, p := range posts {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				p.CreatedAt.Local().Format(time.RFC3339), p.Instance, p.AppName, p.Account, p.StatusID, p.Visibility, len(p.MediaIDs), p.Command)
+		}
+		return w.Flush()
+	},
+}
+
+// parseHistoryTime as RFC 3339, a local date or a duration before now. Empty
+// returns the zero time.
+func parseHistoryTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time, date or duration", s)
+}
+
+// recordPost in the ledger. The status was already submitted, so failing to
+// record it is only logged.
+func recordPost(ctx context.Context, cmd *cobra.Command, appName string, status toot.Status, statusID string) {
+	err := ledger.Record(ctx, ledger.Post{
+		Instance:    instance,
+		AppName:     appName,
+		Account:     app.AccountName(ctx),
+		StatusID:    statusID,
+		Visibility:  status.Visibility.String(),
+		MediaIDs:    status.MediaIDs,
+		ContentHash: ledger.ContentHash(status.Text, status.Spoiler),
+		Command:     strings.TrimSpace(cmd.CommandPath()),
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("status_id", statusID).Msg("failed to record post")
+	}
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/quells/mastobot/internal/discovery"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	instanceTTL     time.Duration
+	instanceRefresh bool
+)
+
+func init() {
+	rootCmd.PersistentFlags().DurationVar(&instanceTTL, "instance-ttl", 24*time.Hour, "How long discovered instance capabilities are cached")
+
+	instanceCmd.Flags().StringVar(&instance, "instance", "", "Mastodon (or compatible) instance to interact with")
+	must(instanceCmd.MarkFlagRequired("instance"))
+	instanceCmd.Flags().BoolVar(&instanceRefresh, "refresh", false, "Discover again instead of using the cache")
+	rootCmd.AddCommand(instanceCmd)
+}
+
+var instanceCmd = &cobra.Command{
+	Use:   "instance",
+	Short: "Show instance capabilities",
+	Long:  "Show the software, version and posting limits discovered from NodeInfo and the instance API.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ttl := instanceTTL
+		if instanceRefresh {
+			ttl = 0
+		}
+
+		info, err := discovery.Get(cmd.Context(), instance, ttl)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	},
+}
+
+// instanceLimits for validating posts. Falls back to the defaults of a vanilla
+// Mastodon instance if discovery fails, so posting is not blocked by it.
+func instanceLimits(ctx context.Context) discovery.Instance {
+	info, err := discovery.Get(ctx, instance, instanceTTL)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to discover instance capabilities")
+		info = discovery.Defaults()
+	}
+	return info
+}
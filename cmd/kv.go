@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/quells/mastobot/internal/app"
+	"github.com/spf13/cobra"
+)
+
+var (
+	kvJSON bool
+	kvTTL  time.Duration
+)
+
+func init() {
+	kvCmd.PersistentFlags().StringVar(&instance, "instance", "", "Mastodon (or compatible) instance to interact with")
+	kvCmd.PersistentFlags().StringVar(&appName, "name", "", "Name of the application")
+	must(kvCmd.MarkPersistentFlagRequired("instance"))
+	must(kvCmd.MarkPersistentFlagRequired("name"))
+
+	kvListCmd.Flags().BoolVar(&kvJSON, "json", false, "Print as JSON")
+	kvCmd.AddCommand(kvListCmd)
+	kvCmd.AddCommand(kvGetCmd)
+	kvSetCmd.Flags().DurationVar(&kvTTL, "ttl", 0, "Expire the value after this long (default never)")
+	kvCmd.AddCommand(kvSetCmd)
+	kvCmd.AddCommand(kvDeleteCmd)
+
+	rootCmd.AddCommand(kvCmd)
+}
+
+var kvCmd = &cobra.Command{
+	Use:   "kv",
+	Short: "Inspect and edit values stored by an application",
+}
+
+var kvListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List stored values",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		values, err := app.ListValues(cmd.Context(), instance, appName)
+		if err != nil {
+			return err
+		}
+
+		if kvJSON {
+			if values == nil {
+				values = []app.Value{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(values)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "KEY\tVALUE\tEXPIRES")
+		for _, v := range values {
+			expires := "never"
+			if !v.ExpiresAt.IsZero() {
+				expires = v.ExpiresAt.Local().Format(time.RFC3339)
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", v.Key, v.Value, expires)
+		}
+		return w.Flush()
+	},
+}
+
+var kvGetCmd = &cobra.Command{
+	Use:   "get KEY",
+	Short: "Print a stored value",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value, err := app.GetValue(cmd.Context(), instance, appName, args[0])
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			return fmt.Errorf("%q is not set", args[0])
+		}
+
+		_, _ = fmt.Fprintln(os.Stdout, value)
+		return nil
+	},
+}
+
+var kvSetCmd = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Short: "Store a value",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var expiresAt time.Time
+		if kvTTL > 0 {
+			expiresAt = time.Now().Add(kvTTL)
+		}
+
+		return app.SetValueUntil(cmd.Context(), instance, appName, args[0], args[1], expiresAt)
+	},
+}
+
+var kvDeleteCmd = &cobra.Command{
+	Use:   "delete KEY",
+	Short: "Delete a stored value",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := app.DeleteValue(cmd.Context(), instance, appName, args[0])
+		if errors.Is(err, app.ErrNoValue) {
+			err = fmt.Errorf("%q is not set", args[0])
+		}
+		return err
+	},
+}
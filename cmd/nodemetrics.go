@@ -22,6 +22,7 @@ var (
 func init() {
 	nodemetricsCmd.PersistentFlags().StringVar(&instance, "instance", "", "Mastodon (or compatible) instance to interact with")
 	must(nodemetricsCmd.MarkPersistentFlagRequired("instance"))
+	nodemetricsCmd.PersistentFlags().StringVar(&account, "account", "", accountUsage)
 
 	nodemetricsCmd.Flags().StringVar(&metricsURL, "metrics-url", "", "URL of the node_exporter metrics")
 	must(nodemetricsCmd.MarkFlagRequired("metrics-url"))
@@ -72,41 +73,35 @@ type nodemetricsState struct {
 }
 
 func nodemetricsGetPrevState(ctx context.Context, appName string) (prev nodemetricsState, err error) {
-	var systemTime, networkRx, networkTx string
-	systemTime, err = app.GetValue(ctx, instance, appName, "systemTime")
-	if err != nil {
-		return
-	}
-	if systemTime == "" {
+	var systemTime, networkRx, networkTx int64
+	var ok bool
+	systemTime, ok, err = app.GetInt64(ctx, instance, appName, "systemTime")
+	if err != nil || !ok {
 		return
 	}
-	networkRx, err = app.GetValue(ctx, instance, appName, "networkRx")
+	networkRx, _, err = app.GetInt64(ctx, instance, appName, "networkRx")
 	if err != nil {
 		return
 	}
-	networkTx, err = app.GetValue(ctx, instance, appName, "networkTx")
+	networkTx, _, err = app.GetInt64(ctx, instance, appName, "networkTx")
 	if err != nil {
 		return
 	}
 
-	prev.systemTime, _ = strconv.ParseUint(systemTime, 10, 64)
-	prev.networkRx, _ = strconv.ParseUint(networkRx, 10, 64)
-	prev.networkTx, _ = strconv.ParseUint(networkTx, 10, 64)
+	prev.systemTime = uint64(systemTime)
+	prev.networkRx = uint64(networkRx)
+	prev.networkTx = uint64(networkTx)
 	return
 }
 
 func nodemetricsSaveState(ctx context.Context, appName string, m *nodeexporter.NodeMetrics) {
-	var systemTime, networkRx, networkTx string
-	systemTime = strconv.FormatUint(m.TimeSeconds, 10)
-	networkRx = strconv.FormatUint(m.NetworkReceiveBytes, 10)
-	networkTx = strconv.FormatUint(m.NetworkTransmitBytes, 10)
-	if err := app.SetValue(ctx, instance, appName, "systemTime", systemTime); err != nil {
+	if err := app.SetInt64(ctx, instance, appName, "systemTime", int64(m.TimeSeconds)); err != nil {
 		log.Error().Err(err).Msg("failed to save systemTime state")
 	}
-	if err := app.SetValue(ctx, instance, appName, "networkRx", networkRx); err != nil {
+	if err := app.SetInt64(ctx, instance, appName, "networkRx", int64(m.NetworkReceiveBytes)); err != nil {
 		log.Error().Err(err).Msg("failed to save networkRx state")
 	}
-	if err := app.SetValue(ctx, instance, appName, "networkTx", networkTx); err != nil {
+	if err := app.SetInt64(ctx, instance, appName, "networkTx", int64(m.NetworkTransmitBytes)); err != nil {
 		log.Error().Err(err).Msg("failed to save networkTx state")
 	}
 }
@@ -133,6 +128,14 @@ var nodemetricsCmd = &cobra.Command{
 		status := toot.Status{
 			Text:       nodemetricsToot(metrics, prevState),
 			Visibility: toot.VisibilityPrivate,
+			Language:   statusLanguage(ctx, appName, ""),
+			// a re-run for the same scrape posts nothing new
+			IdempotencyKey: toot.IdempotencyKey(appName, strconv.FormatUint(metrics.TimeSeconds, 10)),
+		}
+
+		if status.Language == "" {
+			// the metrics are in English, too terse to be detected reliably
+			status.Language = "en"
 		}
 
 		if dryRun {
@@ -140,17 +143,22 @@ var nodemetricsCmd = &cobra.Command{
 			return nil
 		}
 
-		_, err = toot.VerifyCredentials(ctx, instance, appName)
+		var c *toot.Client
+		c, err = checkToken(ctx, appName, "write:statuses")
 		if err != nil {
 			return err
 		}
 
+		// the metrics are more useful cut short than not posted at all
+		status.Text = toot.Truncate(status.Text, instanceLimits(ctx).MaxCharacters)
+
 		var id string
-		id, err = status.Submit(ctx, instance, "nodemetrics")
+		id, err = c.SubmitStatus(ctx, status)
 		if err != nil {
 			return err
 		}
 		_, _ = fmt.Fprintln(os.Stdout, id)
+		recordPost(ctx, cmd, appName, status, id)
 
 		nodemetricsSaveState(ctx, appName, metrics)
 
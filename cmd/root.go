@@ -8,7 +8,10 @@ import (
 	"sync"
 	"time"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/quells/mastobot/internal/app"
+	"github.com/quells/mastobot/internal/crypt"
 	"github.com/quells/mastobot/internal/dbcontext"
 	"github.com/quells/mastobot/internal/dbmigrations"
 	"github.com/rs/zerolog"
@@ -46,15 +49,24 @@ func must(err error) {
 var (
 	connStr string
 	db      *sql.DB
+	store   *app.SQLStore
 
+	keyFile  string
 	instance string
+	account  string
 	timeout  time.Duration
 
-	v      bool
-	vv     bool
-	dryRun bool
+	v         bool
+	vv        bool
+	dryRun    bool
+	noMigrate bool
 )
 
+// manualMigrations annotates commands which manage the database schema
+// themselves, so migrations are not applied and secrets are not checked
+// before they run.
+const manualMigrations = "manual-migrations"
+
 var rootCmd = &cobra.Command{
 	Use:   "mastobot",
 	Short: "Mastodon Bots",
@@ -67,8 +79,10 @@ var rootCmd = &cobra.Command{
 			zerolog.SetGlobalLevel(zerolog.DebugLevel)
 		}
 
+		driver := dbcontext.Driver(connStr)
+
 		var err error
-		db, err = sql.Open("sqlite3", connStr)
+		db, err = sql.Open(driver, connStr)
 		must(err)
 		registerShutdown(func() {
 			log.Debug().Msg("closing database connection")
@@ -77,17 +91,42 @@ var rootCmd = &cobra.Command{
 			}
 		})
 		must(db.Ping())
-		must(dbmigrations.Apply(db))
+
+		manual := cmd.Annotations[manualMigrations] != ""
+		switch {
+		case manual:
+		case noMigrate:
+			must(dbmigrations.Check(db, driver))
+		default:
+			must(dbmigrations.Apply(db, driver))
+		}
 
 		ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
 		registerShutdown(cancel)
 		ctx = dbcontext.Set(ctx, db)
+		ctx = dbcontext.SetDialect(ctx, driver)
+
+		store = app.NewSQLStore(db, driver)
+		ctx = app.Set(ctx, store)
+		if account != "" {
+			ctx = app.SetAccount(ctx, app.NormalizeAcct(account, instance))
+		}
+
+		key, err := readKey(keyFile, "MASTOBOT_KEY")
+		must(err)
+		ctx = crypt.Set(ctx, key)
+		if !manual {
+			must(store.CheckKey(ctx, key))
+		}
+
 		cmd.SetContext(ctx)
 	},
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringVar(&connStr, "db", "file:mastobot.db?_busy_timeout=5000&_journal_mode=WAL", "sqlite database connection string")
+	rootCmd.PersistentFlags().StringVar(&connStr, "db", "file:mastobot.db?_busy_timeout=5000&_journal_mode=WAL", "sqlite database connection string or postgres:// URL")
+	rootCmd.PersistentFlags().StringVar(&keyFile, "key-file", "", "Read the key used to encrypt secrets in the database from file (default $MASTOBOT_KEY)")
+	rootCmd.PersistentFlags().BoolVar(&noMigrate, "no-migrate", false, "Do not apply database migrations; see db up")
 	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 10*time.Second, "Request timeout")
 
 	rootCmd.PersistentFlags().BoolVarP(&v, "log_info", "v", false, "Log info level")
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/quells/mastobot/internal/secret"
+	"github.com/spf13/cobra"
+)
+
+// secretFlags read a secret from a file, stdin, an environment variable or an
+// interactive prompt, keeping it out of shell history and the process list.
+type secretFlags struct {
+	name   string
+	prompt string
+	env    string
+	value  string // set by a deprecated plain flag, if any
+	file   string
+	stdin  bool
+}
+
+// stdinFlags of each command, of which only one may be used as stdin can only
+// be read once.
+var stdinFlags = map[*cobra.Command][]string{}
+
+func addSecretFlags(cmd *cobra.Command, name, prompt, env string) *secretFlags {
+	f := &secretFlags{name: name, prompt: prompt, env: env}
+	cmd.Flags().StringVar(&f.file, name+"-file", "", fmt.Sprintf("Read %s from file", name))
+	cmd.Flags().BoolVar(&f.stdin, name+"-stdin", false, fmt.Sprintf("Read %s from stdin", name))
+
+	stdinFlags[cmd] = append(stdinFlags[cmd], name+"-stdin")
+	if len(stdinFlags[cmd]) > 1 {
+		cmd.MarkFlagsMutuallyExclusive(stdinFlags[cmd]...)
+	}
+	return f
+}
+
+func (f *secretFlags) read() (string, error) {
+	if f.value != "" {
+		return f.value, nil
+	}
+
+	value, err := secret.Source{
+		Name:  f.prompt,
+		File:  f.file,
+		Stdin: f.stdin,
+		Env:   f.env,
+	}.Read()
+	if errors.Is(err, secret.ErrNotProvided) && f.file == "" && !f.stdin {
+		err = fmt.Errorf("no %s provided; use --%s-file, --%s-stdin or set %s", f.name, f.name, f.name, f.env)
+	}
+	return value, err
+}
@@ -14,6 +14,8 @@ func init() {
 var sqliteCmd = &cobra.Command{
 	Use:   "sqlite",
 	Short: "Test if SQLite was correctly cross-compiled",
+	// Only needs the sqlite driver, not the schema
+	Annotations: map[string]string{manualMigrations: "true"},
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		row := db.QueryRow(`WITH t AS (SELECT 1 AS c UNION SELECT 2 as C) SELECT SUM(c) FROM t`)
 		var result int
@@ -0,0 +1,235 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/quells/mastobot/internal/di"
+	"github.com/rs/zerolog/log"
+)
+
+// Account which holds its own token for an application, so one application
+// can post as several accounts on an instance. Tokens, TOTP secrets and use
+// are recorded for the account selected in the context with SetAccount, or
+// for the application itself if none is.
+type Account struct {
+	Instance  string    `json:"instance"`
+	AppName   string    `json:"app_name"`
+	Acct      string    `json:"acct"`
+	AccountID string    `json:"account_id,omitempty"` // empty until verified
+	Username  string    `json:"username,omitempty"`   // empty until verified
+	Scopes    string    `json:"scopes"`
+	HasToken  bool      `json:"has_token"`
+	LastUsed  time.Time `json:"last_used,omitempty"` // zero if never used
+}
+
+// AccountSecretColumns of the accounts table, which are encrypted with the key
+// in the context, if any.
+var AccountSecretColumns = []string{"access_token", "refresh_token", "otp_secret"}
+
+type accountKeyType struct{}
+
+var accountKey = accountKeyType{}
+
+// SetAccount to act as. An empty acct selects the application's own token.
+func SetAccount(ctx context.Context, acct string) context.Context {
+	return di.Set(ctx, accountKey, acct)
+}
+
+// AccountName selected in the context, empty if none is.
+func AccountName(ctx context.Context) string {
+	acct, err := di.Get[accountKeyType, string](ctx, accountKey, "account")
+	if err != nil {
+		return ""
+	}
+	return acct
+}
+
+// NormalizeAcct without a leading @ or the domain of the instance, as the
+// instance reports its local accounts.
+func NormalizeAcct(acct, instance string) string {
+	acct = strings.TrimPrefix(acct, "@")
+	if instance != "" {
+		acct = strings.TrimSuffix(acct, "@"+instance)
+	}
+	return acct
+}
+
+// noToken for a missing row of the tokenTable. Accounts are only stored once
+// they have been issued a token or TOTP secret.
+func noToken(ctx context.Context, instance, appName string) error {
+	if acct := AccountName(ctx); acct != "" {
+		return fmt.Errorf("%w for account %q", ErrNoAccessToken, acct)
+	}
+	return notRegistered(instance, appName)
+}
+
+// tokenTable holding the token of the account selected in the context, or of
+// the application itself.
+func tokenTable(ctx context.Context, instance, appName string) (table string, where goqu.Ex) {
+	if acct := AccountName(ctx); acct != "" {
+		return "accounts", accountRow(instance, appName, acct)
+	}
+	return "apps", appRow(instance, appName)
+}
+
+// accountRow identifies a row of the accounts table.
+func accountRow(instance, appName, acct string) goqu.Ex {
+	return goqu.Ex{"instance": instance, "app_name": appName, "acct": acct}
+}
+
+// saveAccountToken, adding the account if it does not exist yet.
+func (s *SQLStore) saveAccountToken(ctx context.Context, db execQuerier, instance, appName, acct string, token Token) (err error) {
+	var accessToken string
+	accessToken, err = s.sealSecret(ctx, db, "accounts", "access_token", accountRow(instance, appName, acct), token.AccessToken)
+	if err != nil {
+		return
+	}
+
+	var refreshToken, expiresAt any
+	if token.RefreshToken != "" {
+		refreshToken, err = s.sealSecret(ctx, db, "accounts", "refresh_token", accountRow(instance, appName, acct), token.RefreshToken)
+		if err != nil {
+			return
+		}
+	}
+	if !token.ExpiresAt.IsZero() {
+		expiresAt = token.ExpiresAt.Unix()
+	}
+
+	var stmt string
+	var params []any
+	stmt, params, err = s.Dialect.
+		Insert("accounts").
+		Cols("instance", "app_name", "acct", "access_token", "refresh_token", "scopes", "token_expires_at").
+		Vals(goqu.Vals{instance, appName, acct, accessToken, refreshToken, token.Scopes, expiresAt}).
+		OnConflict(
+			goqu.DoUpdate(
+				"instance, app_name, acct",
+				goqu.Record{
+					"access_token":     accessToken,
+					"refresh_token":    refreshToken,
+					"scopes":           token.Scopes,
+					"token_expires_at": expiresAt,
+				},
+			)).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	_, err = db.ExecContext(ctx, stmt, params...)
+	return
+}
+
+// ListAccounts of the application ordered by acct.
+func (s *SQLStore) ListAccounts(ctx context.Context, instance, appName string) (accounts []Account, err error) {
+	var query string
+	var params []any
+	query, params, err = s.Dialect.
+		Select("instance", "app_name", "acct", "account_id", "username", "scopes", "access_token", "last_used_at").
+		From("accounts").
+		Where(goqu.Ex{
+			"instance": instance,
+			"app_name": appName,
+		}).
+		Order(goqu.C("acct").Asc()).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(query)
+
+	var rows *sql.Rows
+	rows, err = s.DB.QueryContext(ctx, query, params...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a Account
+		var token sql.NullString
+		var lastUsed sql.NullInt64
+		err = rows.Scan(&a.Instance, &a.AppName, &a.Acct, &a.AccountID, &a.Username, &a.Scopes, &token, &lastUsed)
+		if err != nil {
+			return
+		}
+
+		a.HasToken = token.String != ""
+		if lastUsed.Valid {
+			a.LastUsed = time.Unix(lastUsed.Int64, 0)
+		}
+		accounts = append(accounts, a)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// SaveAccountInfo reported by the instance for the account's token.
+func (s *SQLStore) SaveAccountInfo(ctx context.Context, instance, appName, acct, accountID, username string) (err error) {
+	var stmt string
+	var params []any
+	stmt, params, err = s.Dialect.
+		Update("accounts").
+		Set(goqu.Record{
+			"account_id": accountID,
+			"username":   username,
+		}).
+		Where(goqu.Ex{
+			"instance": instance,
+			"app_name": appName,
+			"acct":     acct,
+		}).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	_, err = s.DB.ExecContext(ctx, stmt, params...)
+	return
+}
+
+// RemoveAccount and its token from the application. The token is not revoked
+// with the instance.
+func (s *SQLStore) RemoveAccount(ctx context.Context, instance, appName, acct string) (err error) {
+	var stmt string
+	var params []any
+	stmt, params, err = s.Dialect.
+		Delete("accounts").
+		Where(goqu.Ex{
+			"instance": instance,
+			"app_name": appName,
+			"acct":     acct,
+		}).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	var result sql.Result
+	result, err = s.DB.ExecContext(ctx, stmt, params...)
+	if err != nil {
+		return
+	}
+
+	var n int64
+	n, err = result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		err = fmt.Errorf("account %q is not stored for %q on %q", acct, appName, instance)
+		return
+	}
+
+	return
+}
@@ -6,14 +6,15 @@ import (
 	"errors"
 
 	"github.com/doug-martin/goqu/v9"
-	"github.com/quells/mastobot/internal/dbcontext"
 	"github.com/rs/zerolog/log"
 )
 
-func Exists(ctx context.Context, instance, appName string) (exists bool, err error) {
+var ErrNoAccessToken = errors.New("no access token stored")
+
+func (s *SQLStore) Exists(ctx context.Context, instance, appName string) (exists bool, err error) {
 	var query string
 	var params []any
-	query, params, err = goqu.
+	query, params, err = s.Dialect.
 		Select("instance").
 		From("apps").
 		Where(goqu.Ex{
@@ -26,13 +27,7 @@ func Exists(ctx context.Context, instance, appName string) (exists bool, err err
 	}
 	log.Debug().Msg(query)
 
-	var db *sql.DB
-	db, err = dbcontext.From(ctx)
-	if err != nil {
-		return
-	}
-
-	err = db.QueryRow(query, params...).Scan(&instance)
+	err = s.DB.QueryRow(query, params...).Scan(&instance)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			err = nil
@@ -44,26 +39,25 @@ func Exists(ctx context.Context, instance, appName string) (exists bool, err err
 	return
 }
 
-func Register(ctx context.Context, instance, appName, appID, clientID, clientSecret string) (err error) {
+func (s *SQLStore) Register(ctx context.Context, instance, appName, appID, clientID, clientSecret, redirectURI, scopes string) (err error) {
+	clientSecret, err = s.sealSecret(ctx, s.DB, "apps", "client_secret", appRow(instance, appName), clientSecret)
+	if err != nil {
+		return
+	}
+
 	var stmt string
 	var params []any
-	stmt, params, err = goqu.
+	stmt, params, err = s.Dialect.
 		Insert("apps").
-		Cols("instance", "app_name", "app_id", "client_id", "client_secret").
-		Vals(goqu.Vals{instance, appName, appID, clientID, clientSecret}).
+		Cols("instance", "app_name", "app_id", "client_id", "client_secret", "redirect_uri", "scopes").
+		Vals(goqu.Vals{instance, appName, appID, clientID, clientSecret, redirectURI, scopes}).
 		ToSQL()
 	if err != nil {
 		return
 	}
 	log.Debug().Msg(stmt)
 
-	var db *sql.DB
-	db, err = dbcontext.From(ctx)
-	if err != nil {
-		return
-	}
-
-	_, err = db.ExecContext(ctx, stmt, params...)
+	_, err = s.DB.ExecContext(ctx, stmt, params...)
 	if err != nil {
 		return
 	}
@@ -71,10 +65,10 @@ func Register(ctx context.Context, instance, appName, appID, clientID, clientSec
 	return nil
 }
 
-func GetClientSecrets(ctx context.Context, instance, appName string) (clientID, clientSecret string, err error) {
+func (s *SQLStore) GetClientSecrets(ctx context.Context, instance, appName string) (clientID, clientSecret string, err error) {
 	var query string
 	var params []any
-	query, params, err = goqu.
+	query, params, err = s.Dialect.
 		Select("client_id", "client_secret").
 		From("apps").
 		Where(goqu.Ex{
@@ -87,13 +81,15 @@ func GetClientSecrets(ctx context.Context, instance, appName string) (clientID,
 	}
 	log.Debug().Msg(query)
 
-	var db *sql.DB
-	db, err = dbcontext.From(ctx)
+	err = s.DB.QueryRow(query, params...).Scan(&clientID, &clientSecret)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = notRegistered(instance, appName)
+		}
 		return
 	}
 
-	err = db.QueryRow(query, params...).Scan(&clientID, &clientSecret)
+	clientSecret, err = openSecret(ctx, "apps", "client_secret", appRow(instance, appName), clientSecret)
 	if err != nil {
 		return
 	}
@@ -101,14 +97,13 @@ func GetClientSecrets(ctx context.Context, instance, appName string) (clientID,
 	return
 }
 
-func UpdateAccessToken(ctx context.Context, instance, appName, token string) (err error) {
-	var stmt string
+// GetRedirectURI the application was registered with.
+func (s *SQLStore) GetRedirectURI(ctx context.Context, instance, appName string) (redirectURI string, err error) {
+	var query string
 	var params []any
-	stmt, params, err = goqu.
-		Update("apps").
-		Set(goqu.Record{
-			"access_token": token,
-		}).
+	query, params, err = s.Dialect.
+		Select("redirect_uri").
+		From("apps").
 		Where(goqu.Ex{
 			"instance": instance,
 			"app_name": appName,
@@ -117,31 +112,65 @@ func UpdateAccessToken(ctx context.Context, instance, appName, token string) (er
 	if err != nil {
 		return
 	}
-	log.Debug().Msg(stmt)
+	log.Debug().Msg(query)
+
+	err = s.DB.QueryRow(query, params...).Scan(&redirectURI)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = notRegistered(instance, appName)
+		}
+		return
+	}
+
+	return
+}
+
+// GetScopes granted to the application's access token, or requested when the
+// application was registered if no token has been issued yet. Space separated.
+func (s *SQLStore) GetScopes(ctx context.Context, instance, appName string) (scopes string, err error) {
+	if acct := AccountName(ctx); acct != "" {
+		scopes, err = s.accountScopes(ctx, instance, appName, acct)
+		if err != nil || scopes != "" {
+			return
+		}
+	}
 
-	var db *sql.DB
-	db, err = dbcontext.From(ctx)
+	var query string
+	var params []any
+	query, params, err = s.Dialect.
+		Select("scopes").
+		From("apps").
+		Where(goqu.Ex{
+			"instance": instance,
+			"app_name": appName,
+		}).
+		ToSQL()
 	if err != nil {
 		return
 	}
+	log.Debug().Msg(query)
 
-	_, err = db.ExecContext(ctx, stmt, params...)
+	err = s.DB.QueryRow(query, params...).Scan(&scopes)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = notRegistered(instance, appName)
+		}
 		return
 	}
 
 	return
 }
 
-func GetAccessToken(ctx context.Context, instance, appName string) (token string, err error) {
+func (s *SQLStore) accountScopes(ctx context.Context, instance, appName, acct string) (scopes string, err error) {
 	var query string
 	var params []any
-	query, params, err = goqu.
-		Select("access_token").
-		From("apps").
+	query, params, err = s.Dialect.
+		Select("scopes").
+		From("accounts").
 		Where(goqu.Ex{
 			"instance": instance,
 			"app_name": appName,
+			"acct":     acct,
 		}).
 		ToSQL()
 	if err != nil {
@@ -149,86 +178,290 @@ func GetAccessToken(ctx context.Context, instance, appName string) (token string
 	}
 	log.Debug().Msg(query)
 
-	var db *sql.DB
-	db, err = dbcontext.From(ctx)
+	err = s.DB.QueryRow(query, params...).Scan(&scopes)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	return
+}
+
+// ImportAccessToken created outside of mastobot, e.g. in the instance's web
+// interface. Adds the application if it is not registered yet. The client
+// credentials are only updated if a client ID is provided.
+func (s *SQLStore) ImportAccessToken(ctx context.Context, instance, appName, clientID, clientSecret, token, scopes string) (err error) {
+	if acct := AccountName(ctx); acct != "" {
+		return s.importAccountToken(ctx, instance, appName, acct, clientID, clientSecret, token, scopes)
+	}
+
+	row := appRow(instance, appName)
+	if clientSecret, err = s.sealSecret(ctx, s.DB, "apps", "client_secret", row, clientSecret); err != nil {
+		return
+	}
+	if token, err = s.sealSecret(ctx, s.DB, "apps", "access_token", row, token); err != nil {
+		return
+	}
+
+	update := goqu.Record{
+		"access_token":     token,
+		"scopes":           scopes,
+		"refresh_token":    nil,
+		"token_expires_at": nil,
+	}
+	if clientID != "" {
+		update["client_id"] = clientID
+		update["client_secret"] = clientSecret
+	}
+
+	var stmt string
+	var params []any
+	stmt, params, err = s.Dialect.
+		Insert("apps").
+		Cols("instance", "app_name", "app_id", "client_id", "client_secret", "access_token", "scopes").
+		Vals(goqu.Vals{instance, appName, "", clientID, clientSecret, token, scopes}).
+		OnConflict(
+			goqu.DoUpdate(
+				"instance, app_name",
+				update,
+			)).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	_, err = s.DB.ExecContext(ctx, stmt, params...)
 	if err != nil {
 		return
 	}
 
-	err = db.QueryRow(query, params...).Scan(&token)
+	return nil
+}
+
+// importAccountToken adds the application without a token of its own if it is
+// not registered yet, then stores the token for the account.
+func (s *SQLStore) importAccountToken(ctx context.Context, instance, appName, acct, clientID, clientSecret, token, scopes string) (err error) {
+	if clientSecret, err = s.sealSecret(ctx, s.DB, "apps", "client_secret", appRow(instance, appName), clientSecret); err != nil {
+		return
+	}
+
+	conflict := goqu.DoNothing()
+	if clientID != "" {
+		conflict = goqu.DoUpdate("instance, app_name", goqu.Record{
+			"client_id":     clientID,
+			"client_secret": clientSecret,
+		})
+	}
+
+	var stmt string
+	var params []any
+	stmt, params, err = s.Dialect.
+		Insert("apps").
+		Cols("instance", "app_name", "app_id", "client_id", "client_secret", "scopes").
+		Vals(goqu.Vals{instance, appName, "", clientID, clientSecret, scopes}).
+		OnConflict(conflict).
+		ToSQL()
 	if err != nil {
 		return
 	}
 
-	return
+	var tx *sql.Tx
+	tx, err = s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	log.Debug().Msg(stmt)
+	if _, err = tx.ExecContext(ctx, stmt, params...); err != nil {
+		return
+	}
+
+	err = s.saveAccountToken(ctx, tx, instance, appName, acct, Token{AccessToken: token, Scopes: scopes})
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
 }
 
-func GetValue(ctx context.Context, instance, appName, key string) (value string, err error) {
+// GetAccessToken returns ErrNoAccessToken if the application has not been
+// issued a token or it has been revoked.
+func (s *SQLStore) GetAccessToken(ctx context.Context, instance, appName string) (token string, err error) {
+	table, where := tokenTable(ctx, instance, appName)
+
 	var query string
 	var params []any
-	query, params, err = goqu.
-		Select("value").
-		From("kv").
-		Where(goqu.Ex{
-			"instance": instance,
-			"app_name": appName,
-			"key":      key,
-		}).
+	query, params, err = s.Dialect.
+		Select("access_token").
+		From(table).
+		Where(where).
 		ToSQL()
 	if err != nil {
 		return
 	}
 	log.Debug().Msg(query)
 
-	var db *sql.DB
-	db, err = dbcontext.From(ctx)
+	var nullable sql.NullString
+	err = s.DB.QueryRow(query, params...).Scan(&nullable)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = noToken(ctx, instance, appName)
+		}
+		return
+	}
+	if nullable.String == "" {
+		err = ErrNoAccessToken
+		return
+	}
+
+	token, err = openSecret(ctx, table, "access_token", where, nullable.String)
+	return
+}
+
+func (s *SQLStore) ClearAccessToken(ctx context.Context, instance, appName string) (err error) {
+	table, where := tokenTable(ctx, instance, appName)
+
+	var stmt string
+	var params []any
+	stmt, params, err = s.Dialect.
+		Update(table).
+		Set(goqu.Record{
+			"access_token":     nil,
+			"refresh_token":    nil,
+			"token_expires_at": nil,
+		}).
+		Where(where).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	_, err = s.DB.ExecContext(ctx, stmt, params...)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// GetOTPSecret used to generate two-factor codes when signing in, or empty if
+// none is stored.
+func (s *SQLStore) GetOTPSecret(ctx context.Context, instance, appName string) (secret string, err error) {
+	table, where := tokenTable(ctx, instance, appName)
+
+	var query string
+	var params []any
+	query, params, err = s.Dialect.
+		Select("otp_secret").
+		From(table).
+		Where(where).
+		ToSQL()
 	if err != nil {
 		return
 	}
+	log.Debug().Msg(query)
 
-	err = db.QueryRow(query, params...).Scan(&value)
+	var nullable sql.NullString
+	err = s.DB.QueryRow(query, params...).Scan(&nullable)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			err = nil
+			if table == "accounts" {
+				return "", nil
+			}
+			err = notRegistered(instance, appName)
 		}
 		return
 	}
 
+	secret, err = openSecret(ctx, table, "otp_secret", where, nullable.String)
 	return
 }
 
-func SetValue(ctx context.Context, instance, appName, key, value string) (err error) {
+// SetOTPSecret for the account the application signs in as. An empty secret
+// removes it.
+func (s *SQLStore) SetOTPSecret(ctx context.Context, instance, appName, secret string) (err error) {
+	var value any
+	if secret != "" {
+		table, where := tokenTable(ctx, instance, appName)
+		value, err = s.sealSecret(ctx, s.DB, table, "otp_secret", where, secret)
+		if err != nil {
+			return
+		}
+	}
+
+	if acct := AccountName(ctx); acct != "" {
+		return s.setAccountOTPSecret(ctx, instance, appName, acct, value)
+	}
+
 	var stmt string
 	var params []any
-	stmt, params, err = goqu.
-		Insert("kv").
-		Cols("instance", "app_name", "key", "value").
-		Vals(goqu.Vals{instance, appName, key, value}).
-		OnConflict(
-			goqu.DoUpdate(
-				"instance, app_name, key",
-				goqu.Record{"value": value},
-			).Where(goqu.Ex{
-				"instance": instance,
-				"app_name": appName,
-				"key":      key,
-			})).
+	stmt, params, err = s.Dialect.
+		Update("apps").
+		Set(goqu.Record{
+			"otp_secret": value,
+		}).
+		Where(goqu.Ex{
+			"instance": instance,
+			"app_name": appName,
+		}).
 		ToSQL()
 	if err != nil {
 		return
 	}
 	log.Debug().Msg(stmt)
 
-	var db *sql.DB
-	db, err = dbcontext.From(ctx)
+	var result sql.Result
+	result, err = s.DB.ExecContext(ctx, stmt, params...)
 	if err != nil {
 		return
 	}
 
-	_, err = db.ExecContext(ctx, stmt, params...)
+	var n int64
+	n, err = result.RowsAffected()
 	if err != nil {
 		return
 	}
+	if n == 0 {
+		err = notRegistered(instance, appName)
+		return
+	}
 
-	return nil
+	return
+}
+
+// setAccountOTPSecret, adding the account if it does not exist yet.
+func (s *SQLStore) setAccountOTPSecret(ctx context.Context, instance, appName, acct string, value any) (err error) {
+	var exists bool
+	exists, err = s.Exists(ctx, instance, appName)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return notRegistered(instance, appName)
+	}
+
+	var stmt string
+	var params []any
+	stmt, params, err = s.Dialect.
+		Insert("accounts").
+		Cols("instance", "app_name", "acct", "otp_secret").
+		Vals(goqu.Vals{instance, appName, acct, value}).
+		OnConflict(
+			goqu.DoUpdate(
+				"instance, app_name, acct",
+				goqu.Record{"otp_secret": value},
+			)).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	_, err = s.DB.ExecContext(ctx, stmt, params...)
+	return
 }
@@ -0,0 +1,290 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/quells/mastobot/internal/crypt"
+	"github.com/rs/zerolog/log"
+)
+
+// SecretColumns of the apps table, which are encrypted with the key in the
+// context, if any.
+var SecretColumns = []string{"client_secret", "access_token", "refresh_token", "otp_secret"}
+
+// ErrKeyRequired to store secrets in a database encrypted with a key.
+var ErrKeyRequired = errors.New("database is encrypted; set MASTOBOT_KEY or use --key-file to store secrets")
+
+// sealSecret to be stored in the column of the row of table. Without a key,
+// secrets are only stored in plaintext if the database is not encrypted.
+func (s *SQLStore) sealSecret(ctx context.Context, db execQuerier, table, column string, row goqu.Ex, value string) (string, error) {
+	if value != "" {
+		if err := s.requireKey(ctx, db); err != nil {
+			return "", err
+		}
+	}
+	return crypt.From(ctx).Seal(value, SecretAAD(table, column, row))
+}
+
+// RequireKey returns ErrKeyRequired if the database is encrypted but there is
+// no key in the context to store secrets with.
+func (s *SQLStore) RequireKey(ctx context.Context) error {
+	return s.requireKey(ctx, s.DB)
+}
+
+func (s *SQLStore) requireKey(ctx context.Context, db execQuerier) error {
+	if crypt.From(ctx) != nil {
+		return nil
+	}
+	stored, err := s.fingerprint(ctx, db)
+	if err != nil {
+		return err
+	}
+	if stored != "" {
+		return ErrKeyRequired
+	}
+	return nil
+}
+
+// openSecret stored in the column of the row of table.
+func openSecret(ctx context.Context, table, column string, row goqu.Ex, value string) (string, error) {
+	return crypt.From(ctx).Open(value, SecretAAD(table, column, row))
+}
+
+// SecretAAD binds a secret to the table, column and row it is stored in, by
+// the columns identifying the row, so it cannot be copied to another one.
+func SecretAAD(table, column string, row map[string]any) string {
+	parts := []string{table, column}
+	for _, t := range secretTables {
+		if t.name != table {
+			continue
+		}
+		for _, col := range t.key {
+			parts = append(parts, fmt.Sprint(row[col]))
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// appRow identifies a row of the apps table.
+func appRow(instance, appName string) goqu.Ex {
+	return goqu.Ex{"instance": instance, "app_name": appName}
+}
+
+// CheckKey against the fingerprint of the key the database is encrypted with.
+// The first key used with a database is recorded. Without a key, secrets which
+// are already encrypted cannot be read and new ones cannot be stored.
+func (s *SQLStore) CheckKey(ctx context.Context, key *crypt.Key) (err error) {
+	var stored string
+	stored, err = s.fingerprint(ctx, s.DB)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case stored == "" && key != nil:
+		return s.setFingerprint(ctx, s.DB, key)
+	case stored != "" && key == nil:
+		log.Warn().Msg("database is encrypted but no key was provided; set MASTOBOT_KEY or use --key-file")
+	case stored != "" && stored != key.Fingerprint():
+		return fmt.Errorf("key does not match the key the database is encrypted with")
+	}
+
+	return nil
+}
+
+// secretTables with the columns identifying a row and its secret columns.
+var secretTables = []struct {
+	name    string
+	key     []string
+	secrets []string
+}{
+	{"apps", []string{"instance", "app_name"}, SecretColumns},
+	{"accounts", []string{"instance", "app_name", "acct"}, AccountSecretColumns},
+}
+
+// Reencrypt every stored secret, decrypting with from and encrypting with to.
+// Plaintext secrets are encrypted and a nil to stores them in plaintext.
+// Returns the number of applications and accounts updated.
+func (s *SQLStore) Reencrypt(ctx context.Context, from, to *crypt.Key) (n int, err error) {
+	var tx *sql.Tx
+	tx, err = s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for _, t := range secretTables {
+		var updated int
+		updated, err = s.reencryptTable(ctx, tx, t.name, t.key, t.secrets, from, to)
+		if err != nil {
+			return
+		}
+		n += updated
+	}
+
+	if err = s.clearFingerprint(ctx, tx); err != nil {
+		return
+	}
+	if to != nil {
+		if err = s.setFingerprint(ctx, tx, to); err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func (s *SQLStore) reencryptTable(ctx context.Context, tx *sql.Tx, table string, key, secrets []string, from, to *crypt.Key) (n int, err error) {
+	var cols []any
+	for _, col := range append(slices.Clone(key), secrets...) {
+		cols = append(cols, col)
+	}
+
+	var query string
+	query, _, err = s.Dialect.Select(cols...).From(table).ToSQL()
+	if err != nil {
+		return
+	}
+
+	type row struct {
+		key     []string
+		secrets []sql.NullString
+	}
+
+	log.Debug().Msg(query)
+	var rows *sql.Rows
+	rows, err = tx.QueryContext(ctx, query)
+	if err != nil {
+		return
+	}
+
+	var all []row
+	for rows.Next() {
+		r := row{key: make([]string, len(key)), secrets: make([]sql.NullString, len(secrets))}
+		var dest []any
+		for i := range r.key {
+			dest = append(dest, &r.key[i])
+		}
+		for i := range r.secrets {
+			dest = append(dest, &r.secrets[i])
+		}
+		if err = rows.Scan(dest...); err != nil {
+			_ = rows.Close()
+			return
+		}
+		all = append(all, r)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	for _, r := range all {
+		where := goqu.Ex{}
+		for i, col := range key {
+			where[col] = r.key[i]
+		}
+
+		record := goqu.Record{}
+		for i, col := range secrets {
+			if !r.secrets[i].Valid || r.secrets[i].String == "" {
+				continue
+			}
+
+			var value string
+			aad := SecretAAD(table, col, where)
+			value, err = from.Open(r.secrets[i].String, aad)
+			if err != nil {
+				err = fmt.Errorf("%s of %s row %s: %w", col, table, strings.Join(r.key, "/"), err)
+				return
+			}
+			record[col], err = to.Seal(value, aad)
+			if err != nil {
+				return
+			}
+		}
+		if len(record) == 0 {
+			continue
+		}
+
+		var stmt string
+		var params []any
+		stmt, params, err = s.Dialect.
+			Update(table).
+			Set(record).
+			Where(where).
+			ToSQL()
+		if err != nil {
+			return
+		}
+		log.Debug().Strs("key", r.key).Str("table", table).Msg("re-encrypting secrets")
+
+		_, err = tx.ExecContext(ctx, stmt, params...)
+		if err != nil {
+			return
+		}
+		n++
+	}
+
+	return
+}
+
+type execQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (s *SQLStore) fingerprint(ctx context.Context, db execQuerier) (fingerprint string, err error) {
+	var query string
+	query, _, err = s.Dialect.Select("fingerprint").From("encryption").ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(query)
+
+	err = db.QueryRowContext(ctx, query).Scan(&fingerprint)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	return
+}
+
+func (s *SQLStore) setFingerprint(ctx context.Context, db execQuerier, key *crypt.Key) (err error) {
+	var stmt string
+	var params []any
+	stmt, params, err = s.Dialect.
+		Insert("encryption").
+		Cols("fingerprint").
+		Vals(goqu.Vals{key.Fingerprint()}).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	_, err = db.ExecContext(ctx, stmt, params...)
+	return
+}
+
+func (s *SQLStore) clearFingerprint(ctx context.Context, db execQuerier) (err error) {
+	var stmt string
+	stmt, _, err = s.Dialect.Delete("encryption").ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	_, err = db.ExecContext(ctx, stmt)
+	return
+}
@@ -0,0 +1,266 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// Info about a registered application, without its secrets.
+type Info struct {
+	Instance    string    `json:"instance"`
+	AppName     string    `json:"app_name"`
+	AppID       string    `json:"app_id"`
+	RedirectURI string    `json:"redirect_uri"`
+	Scopes      string    `json:"scopes"`
+	HasToken    bool      `json:"has_token"`
+	LastUsed    time.Time `json:"last_used,omitempty"` // zero if never used
+}
+
+var infoCols = []any{"instance", "app_name", "app_id", "redirect_uri", "scopes", "access_token", "last_used_at"}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanInfo(row scanner) (info Info, err error) {
+	var token sql.NullString
+	var lastUsed sql.NullInt64
+	err = row.Scan(&info.Instance, &info.AppName, &info.AppID, &info.RedirectURI, &info.Scopes, &token, &lastUsed)
+	if err != nil {
+		return
+	}
+
+	info.HasToken = token.String != ""
+	if lastUsed.Valid {
+		info.LastUsed = time.Unix(lastUsed.Int64, 0)
+	}
+	return
+}
+
+// List all registered applications ordered by instance and name.
+func (s *SQLStore) List(ctx context.Context) (apps []Info, err error) {
+	var query string
+	var params []any
+	query, params, err = s.Dialect.
+		Select(infoCols...).
+		From("apps").
+		Order(goqu.C("instance").Asc(), goqu.C("app_name").Asc()).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(query)
+
+	var rows *sql.Rows
+	rows, err = s.DB.QueryContext(ctx, query, params...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var info Info
+		info, err = scanInfo(rows)
+		if err != nil {
+			return
+		}
+		apps = append(apps, info)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (s *SQLStore) Get(ctx context.Context, instance, appName string) (info Info, err error) {
+	var query string
+	var params []any
+	query, params, err = s.Dialect.
+		Select(infoCols...).
+		From("apps").
+		Where(goqu.Ex{
+			"instance": instance,
+			"app_name": appName,
+		}).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(query)
+
+	info, err = scanInfo(s.DB.QueryRowContext(ctx, query, params...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = notRegistered(instance, appName)
+		}
+		return
+	}
+
+	return
+}
+
+// Reregister replaces the client credentials of an existing application. The
+// previous access tokens, of the application and its accounts, were issued to
+// the old client and are removed.
+func (s *SQLStore) Reregister(ctx context.Context, instance, appName, appID, clientID, clientSecret, redirectURI, scopes string) (err error) {
+	clientSecret, err = s.sealSecret(ctx, s.DB, "apps", "client_secret", appRow(instance, appName), clientSecret)
+	if err != nil {
+		return
+	}
+
+	where := goqu.Ex{
+		"instance": instance,
+		"app_name": appName,
+	}
+
+	var updateApp, updateAccounts string
+	var appParams, accountParams []any
+	updateApp, appParams, err = s.Dialect.
+		Update("apps").
+		Set(goqu.Record{
+			"app_id":           appID,
+			"client_id":        clientID,
+			"client_secret":    clientSecret,
+			"redirect_uri":     redirectURI,
+			"scopes":           scopes,
+			"access_token":     nil,
+			"refresh_token":    nil,
+			"token_expires_at": nil,
+		}).
+		Where(where).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	updateAccounts, accountParams, err = s.Dialect.
+		Update("accounts").
+		Set(goqu.Record{
+			"access_token":     nil,
+			"refresh_token":    nil,
+			"token_expires_at": nil,
+		}).
+		Where(where).
+		ToSQL()
+	if err != nil {
+		return
+	}
+
+	var tx *sql.Tx
+	tx, err = s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	log.Debug().Msg(updateApp)
+	_, err = tx.ExecContext(ctx, updateApp, appParams...)
+	if err != nil {
+		return
+	}
+
+	log.Debug().Msg(updateAccounts)
+	_, err = tx.ExecContext(ctx, updateAccounts, accountParams...)
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+// Remove the application, its accounts and its stored values.
+func (s *SQLStore) Remove(ctx context.Context, instance, appName string) (err error) {
+	where := goqu.Ex{
+		"instance": instance,
+		"app_name": appName,
+	}
+
+	var deleteApp, deleteAccounts, deleteValues string
+	deleteApp, _, err = s.Dialect.Delete("apps").Where(where).ToSQL()
+	if err != nil {
+		return
+	}
+	deleteAccounts, _, err = s.Dialect.Delete("accounts").Where(where).ToSQL()
+	if err != nil {
+		return
+	}
+	deleteValues, _, err = s.Dialect.Delete("kv").Where(where).ToSQL()
+	if err != nil {
+		return
+	}
+
+	var tx *sql.Tx
+	tx, err = s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	log.Debug().Msg(deleteApp)
+	var result sql.Result
+	result, err = tx.ExecContext(ctx, deleteApp)
+	if err != nil {
+		return
+	}
+
+	var n int64
+	n, err = result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		err = notRegistered(instance, appName)
+		return
+	}
+
+	log.Debug().Msg(deleteAccounts)
+	_, err = tx.ExecContext(ctx, deleteAccounts)
+	if err != nil {
+		return
+	}
+
+	log.Debug().Msg(deleteValues)
+	_, err = tx.ExecContext(ctx, deleteValues)
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+// MarkUsed records when the application's access token was last used.
+func (s *SQLStore) MarkUsed(ctx context.Context, instance, appName string, t time.Time) (err error) {
+	table, where := tokenTable(ctx, instance, appName)
+
+	var stmt string
+	var params []any
+	stmt, params, err = s.Dialect.
+		Update(table).
+		Set(goqu.Record{
+			"last_used_at": t.Unix(),
+		}).
+		Where(where).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	_, err = s.DB.ExecContext(ctx, stmt, params...)
+	if err != nil {
+		return
+	}
+
+	return nil
+}
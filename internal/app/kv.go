@@ -0,0 +1,247 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrNoValue = errors.New("no value stored")
+
+// LanguageKey of the value holding the ISO 639 code of the language an
+// application posts in, unless told otherwise.
+const LanguageKey = "language"
+
+// Value stored for an application.
+type Value struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // zero if the value does not expire
+}
+
+func unexpired(now time.Time) goqu.Expression {
+	return goqu.Or(
+		goqu.C("expires_at").IsNull(),
+		goqu.C("expires_at").Gt(now.Unix()),
+	)
+}
+
+// GetValue returns an empty string if the key is not set or has expired.
+func (s *SQLStore) GetValue(ctx context.Context, instance, appName, key string) (value string, err error) {
+	var query string
+	var params []any
+	query, params, err = s.Dialect.
+		Select("value").
+		From("kv").
+		Where(goqu.Ex{
+			"instance": instance,
+			"app_name": appName,
+			"key":      key,
+		}, unexpired(time.Now())).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(query)
+
+	err = s.DB.QueryRow(query, params...).Scan(&value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+		return
+	}
+
+	return
+}
+
+func (s *SQLStore) SetValue(ctx context.Context, instance, appName, key, value string) (err error) {
+	return s.SetValueUntil(ctx, instance, appName, key, value, time.Time{})
+}
+
+// SetValueUntil expiresAt, after which the key is treated as not set. A zero
+// expiresAt never expires.
+func (s *SQLStore) SetValueUntil(ctx context.Context, instance, appName, key, value string, expiresAt time.Time) (err error) {
+	var expires any
+	if !expiresAt.IsZero() {
+		expires = expiresAt.Unix()
+	}
+
+	var stmt string
+	var params []any
+	stmt, params, err = s.Dialect.
+		Insert("kv").
+		Cols("instance", "app_name", "key", "value", "expires_at").
+		Vals(goqu.Vals{instance, appName, key, value, expires}).
+		OnConflict(
+			goqu.DoUpdate(
+				"instance, app_name, key",
+				goqu.Record{"value": value, "expires_at": expires},
+			)).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	_, err = s.DB.ExecContext(ctx, stmt, params...)
+	if err != nil {
+		return
+	}
+
+	return nil
+}
+
+// ListValues which have not expired, ordered by key.
+func (s *SQLStore) ListValues(ctx context.Context, instance, appName string) (values []Value, err error) {
+	var query string
+	var params []any
+	query, params, err = s.Dialect.
+		Select("key", "value", "expires_at").
+		From("kv").
+		Where(goqu.Ex{
+			"instance": instance,
+			"app_name": appName,
+		}, unexpired(time.Now())).
+		Order(goqu.C("key").Asc()).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(query)
+
+	var rows *sql.Rows
+	rows, err = s.DB.QueryContext(ctx, query, params...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v Value
+		var expiresAt sql.NullInt64
+		if err = rows.Scan(&v.Key, &v.Value, &expiresAt); err != nil {
+			return
+		}
+		if expiresAt.Valid {
+			v.ExpiresAt = time.Unix(expiresAt.Int64, 0)
+		}
+		values = append(values, v)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// DeleteValue returns ErrNoValue if the key is not set.
+func (s *SQLStore) DeleteValue(ctx context.Context, instance, appName, key string) (err error) {
+	var stmt string
+	var params []any
+	stmt, params, err = s.Dialect.
+		Delete("kv").
+		Where(goqu.Ex{
+			"instance": instance,
+			"app_name": appName,
+			"key":      key,
+		}).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	var result sql.Result
+	result, err = s.DB.ExecContext(ctx, stmt, params...)
+	if err != nil {
+		return
+	}
+
+	var n int64
+	n, err = result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		err = ErrNoValue
+		return
+	}
+
+	return
+}
+
+// GetInt64 stored with SetInt64. ok is false if the key is not set.
+func GetInt64(ctx context.Context, instance, appName, key string) (v int64, ok bool, err error) {
+	var s string
+	s, err = GetValue(ctx, instance, appName, key)
+	if err != nil || s == "" {
+		return
+	}
+
+	v, err = strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		err = fmt.Errorf("value of %q is not an integer: %w", key, err)
+		return
+	}
+
+	ok = true
+	return
+}
+
+func SetInt64(ctx context.Context, instance, appName, key string, v int64) error {
+	return SetValue(ctx, instance, appName, key, strconv.FormatInt(v, 10))
+}
+
+// GetTime stored with SetTime. ok is false if the key is not set.
+func GetTime(ctx context.Context, instance, appName, key string) (t time.Time, ok bool, err error) {
+	var s string
+	s, err = GetValue(ctx, instance, appName, key)
+	if err != nil || s == "" {
+		return
+	}
+
+	t, err = time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		err = fmt.Errorf("value of %q is not a time: %w", key, err)
+		return
+	}
+
+	ok = true
+	return
+}
+
+func SetTime(ctx context.Context, instance, appName, key string, t time.Time) error {
+	return SetValue(ctx, instance, appName, key, t.Format(time.RFC3339Nano))
+}
+
+// GetJSON stored with SetJSON into v. ok is false if the key is not set.
+func GetJSON(ctx context.Context, instance, appName, key string, v any) (ok bool, err error) {
+	var s string
+	s, err = GetValue(ctx, instance, appName, key)
+	if err != nil || s == "" {
+		return
+	}
+
+	err = json.Unmarshal([]byte(s), v)
+	if err != nil {
+		err = fmt.Errorf("value of %q is not valid JSON: %w", key, err)
+		return
+	}
+
+	ok = true
+	return
+}
+
+func SetJSON(ctx context.Context, instance, appName, key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return SetValue(ctx, instance, appName, key, string(b))
+}
@@ -0,0 +1,488 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps applications in memory, e.g. for tests. Secrets are not
+// encrypted.
+type MemoryStore struct {
+	mu       sync.Mutex
+	apps     map[appKey]*memoryApp
+	accounts map[memoryAccountKey]*memoryAccount
+	values   map[appKey]map[string]Value
+}
+
+type appKey struct {
+	instance, appName string
+}
+
+type memoryAccountKey struct {
+	instance, appName, acct string
+}
+
+type memoryApp struct {
+	Info
+	clientID     string
+	clientSecret string
+	otpSecret    string
+	token        Token
+}
+
+type memoryAccount struct {
+	Account
+	otpSecret string
+	token     Token
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		apps:     make(map[appKey]*memoryApp),
+		accounts: make(map[memoryAccountKey]*memoryAccount),
+		values:   make(map[appKey]map[string]Value),
+	}
+}
+
+func (s *MemoryStore) get(instance, appName string) (a *memoryApp, err error) {
+	a, ok := s.apps[appKey{instance, appName}]
+	if !ok {
+		return nil, notRegistered(instance, appName)
+	}
+	return a, nil
+}
+
+// account selected in the context. Nil if it is not stored, unless created.
+func (s *MemoryStore) account(ctx context.Context, instance, appName string, create bool) *memoryAccount {
+	acct := AccountName(ctx)
+	k := memoryAccountKey{instance, appName, acct}
+	a, ok := s.accounts[k]
+	if !ok && create {
+		a = &memoryAccount{Account: Account{Instance: instance, AppName: appName, Acct: acct}}
+		s.accounts[k] = a
+	}
+	return a
+}
+
+func (s *MemoryStore) Exists(_ context.Context, instance, appName string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.apps[appKey{instance, appName}]
+	return ok, nil
+}
+
+func (s *MemoryStore) Register(_ context.Context, instance, appName, appID, clientID, clientSecret, redirectURI, scopes string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := appKey{instance, appName}
+	if _, ok := s.apps[k]; ok {
+		return fmt.Errorf("%q is already registered with %q", appName, instance)
+	}
+
+	s.apps[k] = &memoryApp{
+		Info: Info{
+			Instance:    instance,
+			AppName:     appName,
+			AppID:       appID,
+			RedirectURI: redirectURI,
+			Scopes:      scopes,
+		},
+		clientID:     clientID,
+		clientSecret: clientSecret,
+	}
+	return nil
+}
+
+func (s *MemoryStore) Reregister(_ context.Context, instance, appName, appID, clientID, clientSecret, redirectURI, scopes string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, err := s.get(instance, appName)
+	if err != nil {
+		return nil // nothing to update, as with the SQL store
+	}
+
+	a.AppID = appID
+	a.clientID = clientID
+	a.clientSecret = clientSecret
+	a.RedirectURI = redirectURI
+	a.Scopes = scopes
+	a.token = Token{}
+	for k, acc := range s.accounts {
+		if k.instance == instance && k.appName == appName {
+			acc.token = Token{}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Remove(_ context.Context, instance, appName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.get(instance, appName); err != nil {
+		return err
+	}
+
+	k := appKey{instance, appName}
+	delete(s.apps, k)
+	delete(s.values, k)
+	for k := range s.accounts {
+		if k.instance == instance && k.appName == appName {
+			delete(s.accounts, k)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) List(_ context.Context) (apps []Info, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.apps {
+		apps = append(apps, a.info())
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		if apps[i].Instance != apps[j].Instance {
+			return apps[i].Instance < apps[j].Instance
+		}
+		return apps[i].AppName < apps[j].AppName
+	})
+	return apps, nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, instance, appName string) (Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, err := s.get(instance, appName)
+	if err != nil {
+		return Info{}, err
+	}
+	return a.info(), nil
+}
+
+func (a *memoryApp) info() Info {
+	info := a.Info
+	info.HasToken = a.token.AccessToken != ""
+	return info
+}
+
+func (s *MemoryStore) MarkUsed(ctx context.Context, instance, appName string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if AccountName(ctx) != "" {
+		if acc := s.account(ctx, instance, appName, false); acc != nil {
+			acc.LastUsed = time.Unix(t.Unix(), 0)
+		}
+		return nil
+	}
+	if a, err := s.get(instance, appName); err == nil {
+		a.LastUsed = time.Unix(t.Unix(), 0)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetClientSecrets(_ context.Context, instance, appName string) (clientID, clientSecret string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var a *memoryApp
+	if a, err = s.get(instance, appName); err != nil {
+		return
+	}
+	return a.clientID, a.clientSecret, nil
+}
+
+func (s *MemoryStore) GetRedirectURI(_ context.Context, instance, appName string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, err := s.get(instance, appName)
+	if err != nil {
+		return "", err
+	}
+	return a.RedirectURI, nil
+}
+
+func (s *MemoryStore) GetScopes(ctx context.Context, instance, appName string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if acc := s.account(ctx, instance, appName, false); acc != nil && acc.Scopes != "" {
+		return acc.Scopes, nil
+	}
+
+	a, err := s.get(instance, appName)
+	if err != nil {
+		return "", err
+	}
+	return a.Scopes, nil
+}
+
+func (s *MemoryStore) ImportAccessToken(ctx context.Context, instance, appName, clientID, clientSecret, token, scopes string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := appKey{instance, appName}
+	a, ok := s.apps[k]
+	if !ok {
+		a = &memoryApp{Info: Info{Instance: instance, AppName: appName}}
+		s.apps[k] = a
+	}
+
+	if !ok || clientID != "" {
+		a.clientID = clientID
+		a.clientSecret = clientSecret
+	}
+	if AccountName(ctx) != "" {
+		if !ok {
+			a.Scopes = scopes
+		}
+		acc := s.account(ctx, instance, appName, true)
+		acc.Scopes = scopes
+		acc.token = Token{AccessToken: token, Scopes: scopes}
+		return nil
+	}
+	a.Scopes = scopes
+	a.token = Token{AccessToken: token, Scopes: scopes}
+	return nil
+}
+
+func (s *MemoryStore) GetAccessToken(ctx context.Context, instance, appName string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if AccountName(ctx) != "" {
+		acc := s.account(ctx, instance, appName, false)
+		if acc == nil {
+			return "", noToken(ctx, instance, appName)
+		}
+		if acc.token.AccessToken == "" {
+			return "", ErrNoAccessToken
+		}
+		return acc.token.AccessToken, nil
+	}
+
+	a, err := s.get(instance, appName)
+	if err != nil {
+		return "", err
+	}
+	if a.token.AccessToken == "" {
+		return "", ErrNoAccessToken
+	}
+	return a.token.AccessToken, nil
+}
+
+func (s *MemoryStore) ClearAccessToken(ctx context.Context, instance, appName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if AccountName(ctx) != "" {
+		if acc := s.account(ctx, instance, appName, false); acc != nil {
+			acc.token = Token{}
+		}
+		return nil
+	}
+
+	if a, err := s.get(instance, appName); err == nil {
+		a.token = Token{}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetToken(ctx context.Context, instance, appName string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if AccountName(ctx) != "" {
+		acc := s.account(ctx, instance, appName, false)
+		if acc == nil {
+			return Token{}, noToken(ctx, instance, appName)
+		}
+		if acc.token.AccessToken == "" {
+			return Token{}, ErrNoAccessToken
+		}
+		token := acc.token
+		token.Scopes = acc.Scopes
+		return token, nil
+	}
+
+	a, err := s.get(instance, appName)
+	if err != nil {
+		return Token{}, err
+	}
+	if a.token.AccessToken == "" {
+		return Token{}, ErrNoAccessToken
+	}
+
+	token := a.token
+	token.Scopes = a.Scopes
+	return token, nil
+}
+
+func (s *MemoryStore) SaveToken(ctx context.Context, instance, appName string, token Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !token.ExpiresAt.IsZero() {
+		token.ExpiresAt = time.Unix(token.ExpiresAt.Unix(), 0)
+	}
+
+	if AccountName(ctx) != "" {
+		acc := s.account(ctx, instance, appName, true)
+		acc.Scopes = token.Scopes
+		acc.token = token
+		return nil
+	}
+
+	a, err := s.get(instance, appName)
+	if err != nil {
+		return nil // nothing to update, as with the SQL store
+	}
+	a.Scopes = token.Scopes
+	a.token = token
+	return nil
+}
+
+func (s *MemoryStore) GetOTPSecret(ctx context.Context, instance, appName string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if AccountName(ctx) != "" {
+		if acc := s.account(ctx, instance, appName, false); acc != nil {
+			return acc.otpSecret, nil
+		}
+		return "", nil
+	}
+
+	a, err := s.get(instance, appName)
+	if err != nil {
+		return "", err
+	}
+	return a.otpSecret, nil
+}
+
+func (s *MemoryStore) SetOTPSecret(ctx context.Context, instance, appName, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, err := s.get(instance, appName)
+	if err != nil {
+		return err
+	}
+	if AccountName(ctx) != "" {
+		s.account(ctx, instance, appName, true).otpSecret = secret
+		return nil
+	}
+	a.otpSecret = secret
+	return nil
+}
+
+func (s *MemoryStore) ListAccounts(_ context.Context, instance, appName string) (accounts []Account, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, acc := range s.accounts {
+		if k.instance == instance && k.appName == appName {
+			a := acc.Account
+			a.HasToken = acc.token.AccessToken != ""
+			accounts = append(accounts, a)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Acct < accounts[j].Acct
+	})
+	return accounts, nil
+}
+
+func (s *MemoryStore) SaveAccountInfo(_ context.Context, instance, appName, acct, accountID, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if acc, ok := s.accounts[memoryAccountKey{instance, appName, acct}]; ok {
+		acc.AccountID = accountID
+		acc.Username = username
+	}
+	return nil
+}
+
+func (s *MemoryStore) RemoveAccount(_ context.Context, instance, appName, acct string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := memoryAccountKey{instance, appName, acct}
+	if _, ok := s.accounts[k]; !ok {
+		return fmt.Errorf("account %q is not stored for %q on %q", acct, appName, instance)
+	}
+	delete(s.accounts, k)
+	return nil
+}
+
+func (s *MemoryStore) GetValue(_ context.Context, instance, appName, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.values[appKey{instance, appName}][key]
+	if !ok || v.expired(time.Now()) {
+		return "", nil
+	}
+	return v.Value, nil
+}
+
+func (s *MemoryStore) SetValue(ctx context.Context, instance, appName, key, value string) error {
+	return s.SetValueUntil(ctx, instance, appName, key, value, time.Time{})
+}
+
+func (s *MemoryStore) SetValueUntil(_ context.Context, instance, appName, key, value string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := appKey{instance, appName}
+	if s.values[k] == nil {
+		s.values[k] = make(map[string]Value)
+	}
+	if !expiresAt.IsZero() {
+		expiresAt = time.Unix(expiresAt.Unix(), 0)
+	}
+	s.values[k][key] = Value{Key: key, Value: value, ExpiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryStore) ListValues(_ context.Context, instance, appName string) (values []Value, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, v := range s.values[appKey{instance, appName}] {
+		if !v.expired(now) {
+			values = append(values, v)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Key < values[j].Key
+	})
+	return values, nil
+}
+
+func (s *MemoryStore) DeleteValue(_ context.Context, instance, appName, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := appKey{instance, appName}
+	if _, ok := s.values[k][key]; !ok {
+		return ErrNoValue
+	}
+	delete(s.values[k], key)
+	return nil
+}
+
+func (v Value) expired(now time.Time) bool {
+	return !v.ExpiresAt.IsZero() && !v.ExpiresAt.After(now)
+}
@@ -0,0 +1,284 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
+	"github.com/quells/mastobot/internal/di"
+)
+
+// Store of registered applications, their tokens and key-value pairs. Tokens,
+// TOTP secrets and use are those of the account selected in the context with
+// SetAccount, if any.
+type Store interface {
+	Exists(ctx context.Context, instance, appName string) (bool, error)
+	Register(ctx context.Context, instance, appName, appID, clientID, clientSecret, redirectURI, scopes string) error
+	Reregister(ctx context.Context, instance, appName, appID, clientID, clientSecret, redirectURI, scopes string) error
+	Remove(ctx context.Context, instance, appName string) error
+	List(ctx context.Context) ([]Info, error)
+	Get(ctx context.Context, instance, appName string) (Info, error)
+	MarkUsed(ctx context.Context, instance, appName string, t time.Time) error
+
+	GetClientSecrets(ctx context.Context, instance, appName string) (clientID, clientSecret string, err error)
+	GetRedirectURI(ctx context.Context, instance, appName string) (string, error)
+	GetScopes(ctx context.Context, instance, appName string) (string, error)
+
+	ImportAccessToken(ctx context.Context, instance, appName, clientID, clientSecret, token, scopes string) error
+	GetAccessToken(ctx context.Context, instance, appName string) (string, error)
+	ClearAccessToken(ctx context.Context, instance, appName string) error
+	GetToken(ctx context.Context, instance, appName string) (Token, error)
+	SaveToken(ctx context.Context, instance, appName string, token Token) error
+
+	GetOTPSecret(ctx context.Context, instance, appName string) (string, error)
+	SetOTPSecret(ctx context.Context, instance, appName, secret string) error
+
+	ListAccounts(ctx context.Context, instance, appName string) ([]Account, error)
+	SaveAccountInfo(ctx context.Context, instance, appName, acct, accountID, username string) error
+	RemoveAccount(ctx context.Context, instance, appName, acct string) error
+
+	GetValue(ctx context.Context, instance, appName, key string) (string, error)
+	SetValue(ctx context.Context, instance, appName, key, value string) error
+	SetValueUntil(ctx context.Context, instance, appName, key, value string, expiresAt time.Time) error
+	ListValues(ctx context.Context, instance, appName string) ([]Value, error)
+	DeleteValue(ctx context.Context, instance, appName, key string) error
+}
+
+// SQLStore keeps applications in the apps and kv tables. Secrets are encrypted
+// with the key in the context, if any.
+type SQLStore struct {
+	DB      *sql.DB
+	Dialect goqu.DialectWrapper
+}
+
+// NewSQLStore using the SQL dialect of the database, sqlite3 or postgres.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{DB: db, Dialect: goqu.Dialect(dialect)}
+}
+
+var (
+	_ Store = (*SQLStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
+
+func notRegistered(instance, appName string) error {
+	return fmt.Errorf("%q is not registered with %q", appName, instance)
+}
+
+type contextKeyType struct{}
+
+var contextKey = contextKeyType{}
+
+func Set(ctx context.Context, store Store) context.Context {
+	return di.Set(ctx, contextKey, store)
+}
+
+func From(ctx context.Context) (Store, error) {
+	return di.Get[contextKeyType, Store](ctx, contextKey, "app.Store")
+}
+
+// The functions below use the Store in the context.
+
+func Exists(ctx context.Context, instance, appName string) (exists bool, err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.Exists(ctx, instance, appName)
+}
+
+func Register(ctx context.Context, instance, appName, appID, clientID, clientSecret, redirectURI, scopes string) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.Register(ctx, instance, appName, appID, clientID, clientSecret, redirectURI, scopes)
+}
+
+func Reregister(ctx context.Context, instance, appName, appID, clientID, clientSecret, redirectURI, scopes string) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.Reregister(ctx, instance, appName, appID, clientID, clientSecret, redirectURI, scopes)
+}
+
+func Remove(ctx context.Context, instance, appName string) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.Remove(ctx, instance, appName)
+}
+
+func List(ctx context.Context) (apps []Info, err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.List(ctx)
+}
+
+func Get(ctx context.Context, instance, appName string) (info Info, err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.Get(ctx, instance, appName)
+}
+
+func MarkUsed(ctx context.Context, instance, appName string, t time.Time) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.MarkUsed(ctx, instance, appName, t)
+}
+
+func GetClientSecrets(ctx context.Context, instance, appName string) (clientID, clientSecret string, err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.GetClientSecrets(ctx, instance, appName)
+}
+
+func GetRedirectURI(ctx context.Context, instance, appName string) (redirectURI string, err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.GetRedirectURI(ctx, instance, appName)
+}
+
+func GetScopes(ctx context.Context, instance, appName string) (scopes string, err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.GetScopes(ctx, instance, appName)
+}
+
+func ImportAccessToken(ctx context.Context, instance, appName, clientID, clientSecret, token, scopes string) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.ImportAccessToken(ctx, instance, appName, clientID, clientSecret, token, scopes)
+}
+
+func GetAccessToken(ctx context.Context, instance, appName string) (token string, err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.GetAccessToken(ctx, instance, appName)
+}
+
+func ClearAccessToken(ctx context.Context, instance, appName string) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.ClearAccessToken(ctx, instance, appName)
+}
+
+func GetToken(ctx context.Context, instance, appName string) (token Token, err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.GetToken(ctx, instance, appName)
+}
+
+func SaveToken(ctx context.Context, instance, appName string, token Token) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.SaveToken(ctx, instance, appName, token)
+}
+
+func GetOTPSecret(ctx context.Context, instance, appName string) (secret string, err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.GetOTPSecret(ctx, instance, appName)
+}
+
+func SetOTPSecret(ctx context.Context, instance, appName, secret string) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.SetOTPSecret(ctx, instance, appName, secret)
+}
+
+func ListAccounts(ctx context.Context, instance, appName string) (accounts []Account, err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.ListAccounts(ctx, instance, appName)
+}
+
+func SaveAccountInfo(ctx context.Context, instance, appName, acct, accountID, username string) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.SaveAccountInfo(ctx, instance, appName, acct, accountID, username)
+}
+
+func RemoveAccount(ctx context.Context, instance, appName, acct string) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.RemoveAccount(ctx, instance, appName, acct)
+}
+
+func GetValue(ctx context.Context, instance, appName, key string) (value string, err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.GetValue(ctx, instance, appName, key)
+}
+
+func SetValue(ctx context.Context, instance, appName, key, value string) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.SetValue(ctx, instance, appName, key, value)
+}
+
+func SetValueUntil(ctx context.Context, instance, appName, key, value string, expiresAt time.Time) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.SetValueUntil(ctx, instance, appName, key, value, expiresAt)
+}
+
+func ListValues(ctx context.Context, instance, appName string) (values []Value, err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.ListValues(ctx, instance, appName)
+}
+
+func DeleteValue(ctx context.Context, instance, appName, key string) (err error) {
+	var s Store
+	if s, err = From(ctx); err != nil {
+		return
+	}
+	return s.DeleteValue(ctx, instance, appName, key)
+}
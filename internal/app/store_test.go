@@ -0,0 +1,307 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/quells/mastobot/internal/crypt"
+	"github.com/quells/mastobot/internal/dbmigrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postgresEnv names a DSN of a disposable Postgres database to also run the
+// tests against. Its apps, accounts and kv tables are emptied.
+const postgresEnv = "MASTOBOT_TEST_POSTGRES"
+
+func stores(t *testing.T) map[string]Store {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err, "must create database connection")
+	db.SetMaxOpenConns(1)
+	require.NoError(t, dbmigrations.Apply(db, "sqlite3"), "must run database migrations")
+	t.Cleanup(func() { _ = db.Close() })
+
+	stores := map[string]Store{
+		"sqlite3": NewSQLStore(db, "sqlite3"),
+		"memory":  NewMemoryStore(),
+	}
+
+	if dsn := os.Getenv(postgresEnv); dsn != "" {
+		pg, err := sql.Open("postgres", dsn)
+		require.NoError(t, err, "must create database connection")
+		require.NoError(t, dbmigrations.Apply(pg, "postgres"), "must run database migrations")
+		for _, table := range []string{"apps", "accounts", "kv"} {
+			_, err = pg.Exec("DELETE FROM " + table)
+			require.NoError(t, err, "must empty %s", table)
+		}
+		t.Cleanup(func() { _ = pg.Close() })
+		stores["postgres"] = NewSQLStore(pg, "postgres")
+	}
+
+	return stores
+}
+
+func TestStore(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := Set(context.Background(), s)
+
+			exists, err := Exists(ctx, "example.com", "bot")
+			require.NoError(t, err)
+			assert.False(t, exists)
+
+			_, err = GetScopes(ctx, "example.com", "bot")
+			assert.EqualError(t, err, `"bot" is not registered with "example.com"`)
+
+			require.NoError(t, Register(ctx, "example.com", "bot", "1", "id", "secret", "urn:ietf:wg:oauth:2.0:oob", "read"))
+			assert.Error(t, Register(ctx, "example.com", "bot", "1", "id", "secret", "urn:ietf:wg:oauth:2.0:oob", "read"))
+
+			clientID, clientSecret, err := GetClientSecrets(ctx, "example.com", "bot")
+			require.NoError(t, err)
+			assert.Equal(t, "id", clientID)
+			assert.Equal(t, "secret", clientSecret)
+
+			_, err = GetToken(ctx, "example.com", "bot")
+			assert.ErrorIs(t, err, ErrNoAccessToken)
+
+			expires := time.Unix(1700000000, 0)
+			require.NoError(t, SaveToken(ctx, "example.com", "bot", Token{
+				AccessToken:  "access",
+				RefreshToken: "refresh",
+				Scopes:       "read write",
+				ExpiresAt:    expires,
+			}))
+			token, err := GetToken(ctx, "example.com", "bot")
+			require.NoError(t, err)
+			assert.Equal(t, Token{AccessToken: "access", RefreshToken: "refresh", Scopes: "read write", ExpiresAt: expires}, token)
+
+			require.NoError(t, ImportAccessToken(ctx, "example.com", "bot", "", "", "imported", "write"))
+			token, err = GetToken(ctx, "example.com", "bot")
+			require.NoError(t, err)
+			assert.Equal(t, Token{AccessToken: "imported", Scopes: "write"}, token)
+			clientID, _, err = GetClientSecrets(ctx, "example.com", "bot")
+			require.NoError(t, err)
+			assert.Equal(t, "id", clientID, "client credentials are kept without a client ID")
+
+			require.NoError(t, SetValue(ctx, "example.com", "bot", "k", "v1"))
+			require.NoError(t, SetValue(ctx, "example.com", "bot", "k", "v2"))
+			value, err := GetValue(ctx, "example.com", "bot", "k")
+			require.NoError(t, err)
+			assert.Equal(t, "v2", value)
+
+			require.NoError(t, ImportAccessToken(ctx, "a.example", "other", "", "", "token", "read"))
+			apps, err := List(ctx)
+			require.NoError(t, err)
+			require.Len(t, apps, 2)
+			assert.Equal(t, "a.example", apps[0].Instance)
+			assert.True(t, apps[1].HasToken)
+
+			require.NoError(t, ClearAccessToken(ctx, "example.com", "bot"))
+			_, err = GetAccessToken(ctx, "example.com", "bot")
+			assert.ErrorIs(t, err, ErrNoAccessToken)
+
+			require.NoError(t, Remove(ctx, "example.com", "bot"))
+			assert.Error(t, Remove(ctx, "example.com", "bot"))
+			value, err = GetValue(ctx, "example.com", "bot", "k")
+			require.NoError(t, err)
+			assert.Empty(t, value, "values are removed with the application")
+		})
+	}
+}
+
+func testKey(t *testing.T) *crypt.Key {
+	key, err := crypt.ParseKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{'k'}, 32)))
+	require.NoError(t, err)
+	return key
+}
+
+func TestEncryption(t *testing.T) {
+	for name, s := range stores(t) {
+		s, ok := s.(*SQLStore)
+		if !ok {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			key := testKey(t)
+			ctx := crypt.Set(Set(context.Background(), s), key)
+			require.NoError(t, s.CheckKey(ctx, key))
+
+			require.NoError(t, Register(ctx, "example.com", "bot", "1", "id", "secret", "urn:ietf:wg:oauth:2.0:oob", "read"))
+			require.NoError(t, SaveToken(ctx, "example.com", "bot", Token{AccessToken: "access", Scopes: "read"}))
+
+			var stored string
+			require.NoError(t, s.DB.QueryRow("SELECT access_token FROM apps WHERE app_name = 'bot'").Scan(&stored))
+			assert.True(t, crypt.IsEncrypted(stored))
+			token, err := GetAccessToken(ctx, "example.com", "bot")
+			require.NoError(t, err)
+			assert.Equal(t, "access", token)
+
+			// secrets are bound to their row
+			require.NoError(t, ImportAccessToken(ctx, "example.com", "other", "", "", "other-token", "read"))
+			_, err = s.DB.Exec("UPDATE apps SET access_token = (SELECT access_token FROM apps WHERE app_name = 'bot') WHERE app_name = 'other'")
+			require.NoError(t, err)
+			_, err = GetAccessToken(ctx, "example.com", "other")
+			assert.ErrorContains(t, err, "failed to decrypt")
+
+			// another run without the key
+			noKey := NewSQLStore(s.DB, name)
+			ctx = Set(context.Background(), noKey)
+			require.NoError(t, noKey.CheckKey(ctx, nil))
+
+			_, err = GetAccessToken(ctx, "example.com", "bot")
+			assert.ErrorIs(t, err, crypt.ErrNoKey)
+			assert.ErrorIs(t, SaveToken(ctx, "example.com", "bot", Token{AccessToken: "plain", Scopes: "read"}), ErrKeyRequired)
+			assert.ErrorIs(t, SetOTPSecret(ctx, "example.com", "bot", "otp"), ErrKeyRequired)
+			assert.ErrorIs(t, ImportAccessToken(ctx, "example.com", "third", "", "", "plain", "read"), ErrKeyRequired)
+			assert.ErrorIs(t, Register(ctx, "example.com", "third", "1", "id", "secret", "urn:ietf:wg:oauth:2.0:oob", "read"), ErrKeyRequired)
+
+			require.NoError(t, s.DB.QueryRow("SELECT access_token FROM apps WHERE app_name = 'bot'").Scan(&stored))
+			assert.True(t, crypt.IsEncrypted(stored), "nothing was stored in plaintext")
+		})
+	}
+}
+
+func TestRequireKey(t *testing.T) {
+	for name, s := range stores(t) {
+		s, ok := s.(*SQLStore)
+		if !ok {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			ctx := Set(context.Background(), s)
+			require.NoError(t, s.RequireKey(ctx), "the database is not encrypted")
+
+			key := testKey(t)
+			require.NoError(t, s.CheckKey(ctx, key))
+			assert.ErrorIs(t, s.RequireKey(ctx), ErrKeyRequired)
+			assert.NoError(t, s.RequireKey(crypt.Set(ctx, key)))
+		})
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := Set(context.Background(), s)
+			bot := SetAccount(ctx, "bot")
+			other := SetAccount(ctx, "other")
+
+			require.NoError(t, Register(ctx, "example.com", "app", "1", "id", "secret", "urn:ietf:wg:oauth:2.0:oob", "read write"))
+
+			_, err := GetAccessToken(bot, "example.com", "app")
+			assert.ErrorIs(t, err, ErrNoAccessToken)
+			scopes, err := GetScopes(bot, "example.com", "app")
+			require.NoError(t, err)
+			assert.Equal(t, "read write", scopes, "accounts without a token request the application's scopes")
+
+			expiresAt := time.Unix(1700000000, 0)
+			require.NoError(t, SaveToken(bot, "example.com", "app", Token{AccessToken: "bot-token", RefreshToken: "refresh", Scopes: "write:statuses", ExpiresAt: expiresAt}))
+			require.NoError(t, ImportAccessToken(other, "example.com", "app", "", "", "other-token", "read"))
+			require.NoError(t, SetOTPSecret(other, "example.com", "app", "otp"))
+
+			_, err = GetAccessToken(ctx, "example.com", "app")
+			assert.ErrorIs(t, err, ErrNoAccessToken, "accounts do not change the application's token")
+
+			token, err := GetToken(bot, "example.com", "app")
+			require.NoError(t, err)
+			assert.Equal(t, Token{AccessToken: "bot-token", RefreshToken: "refresh", Scopes: "write:statuses", ExpiresAt: expiresAt}, token)
+			otp, err := GetOTPSecret(other, "example.com", "app")
+			require.NoError(t, err)
+			assert.Equal(t, "otp", otp)
+			otp, err = GetOTPSecret(bot, "example.com", "app")
+			require.NoError(t, err)
+			assert.Empty(t, otp)
+
+			used := time.Unix(1700000100, 0)
+			require.NoError(t, MarkUsed(bot, "example.com", "app", used))
+			require.NoError(t, SaveAccountInfo(ctx, "example.com", "app", "bot", "42", "bot"))
+
+			accounts, err := ListAccounts(ctx, "example.com", "app")
+			require.NoError(t, err)
+			require.Len(t, accounts, 2)
+			assert.Equal(t, Account{Instance: "example.com", AppName: "app", Acct: "bot", AccountID: "42", Username: "bot", Scopes: "write:statuses", HasToken: true, LastUsed: used}, accounts[0])
+			assert.Equal(t, "other", accounts[1].Acct)
+
+			require.NoError(t, ClearAccessToken(other, "example.com", "app"))
+			_, err = GetAccessToken(other, "example.com", "app")
+			assert.ErrorIs(t, err, ErrNoAccessToken)
+			token, err = GetToken(bot, "example.com", "app")
+			require.NoError(t, err)
+			assert.Equal(t, "bot-token", token.AccessToken)
+
+			require.NoError(t, RemoveAccount(ctx, "example.com", "app", "other"))
+			assert.Error(t, RemoveAccount(ctx, "example.com", "app", "other"))
+
+			require.NoError(t, Reregister(ctx, "example.com", "app", "2", "id2", "secret2", "urn:ietf:wg:oauth:2.0:oob", "read write"))
+			_, err = GetAccessToken(bot, "example.com", "app")
+			assert.ErrorIs(t, err, ErrNoAccessToken, "tokens were issued to the old client")
+
+			require.NoError(t, Remove(ctx, "example.com", "app"))
+			accounts, err = ListAccounts(ctx, "example.com", "app")
+			require.NoError(t, err)
+			assert.Empty(t, accounts)
+		})
+	}
+}
+
+func TestValues(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := Set(context.Background(), s)
+
+			require.NoError(t, SetValueUntil(ctx, "example.com", "bot", "expired", "x", time.Now().Add(-time.Minute)))
+			value, err := GetValue(ctx, "example.com", "bot", "expired")
+			require.NoError(t, err)
+			assert.Empty(t, value, "expired values are not returned")
+
+			expires := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+			require.NoError(t, SetValueUntil(ctx, "example.com", "bot", "b", "2", expires))
+			require.NoError(t, SetInt64(ctx, "example.com", "bot", "a", -42))
+
+			values, err := ListValues(ctx, "example.com", "bot")
+			require.NoError(t, err)
+			assert.Equal(t, []Value{
+				{Key: "a", Value: "-42"},
+				{Key: "b", Value: "2", ExpiresAt: expires},
+			}, values)
+
+			n, ok, err := GetInt64(ctx, "example.com", "bot", "a")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, int64(-42), n)
+
+			_, ok, err = GetInt64(ctx, "example.com", "bot", "missing")
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			require.NoError(t, SetValue(ctx, "example.com", "bot", "c", "not a number"))
+			_, _, err = GetInt64(ctx, "example.com", "bot", "c")
+			assert.Error(t, err)
+
+			now := time.Date(2026, 10, 17, 12, 30, 0, 0, time.UTC)
+			require.NoError(t, SetTime(ctx, "example.com", "bot", "t", now))
+			got, ok, err := GetTime(ctx, "example.com", "bot", "t")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.True(t, now.Equal(got))
+
+			type state struct{ Seen []string }
+			require.NoError(t, SetJSON(ctx, "example.com", "bot", "j", state{Seen: []string{"1", "2"}}))
+			var st state
+			ok, err = GetJSON(ctx, "example.com", "bot", "j", &st)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, []string{"1", "2"}, st.Seen)
+
+			require.NoError(t, DeleteValue(ctx, "example.com", "bot", "a"))
+			assert.ErrorIs(t, DeleteValue(ctx, "example.com", "bot", "a"), ErrNoValue)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// Token issued to an application.
+type Token struct {
+	AccessToken  string
+	RefreshToken string    // empty if the instance does not issue refresh tokens
+	Scopes       string    // space separated
+	ExpiresAt    time.Time // zero if the access token does not expire
+}
+
+// GetToken returns ErrNoAccessToken if the application has not been issued a
+// token or it has been revoked.
+func (s *SQLStore) GetToken(ctx context.Context, instance, appName string) (token Token, err error) {
+	table, where := tokenTable(ctx, instance, appName)
+
+	var query string
+	var params []any
+	query, params, err = s.Dialect.
+		Select("access_token", "refresh_token", "scopes", "token_expires_at").
+		From(table).
+		Where(where).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(query)
+
+	var accessToken, refreshToken sql.NullString
+	var expiresAt sql.NullInt64
+	err = s.DB.QueryRow(query, params...).Scan(&accessToken, &refreshToken, &token.Scopes, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = noToken(ctx, instance, appName)
+		}
+		return
+	}
+	if accessToken.String == "" {
+		err = ErrNoAccessToken
+		return
+	}
+
+	if token.AccessToken, err = openSecret(ctx, table, "access_token", where, accessToken.String); err != nil {
+		return
+	}
+	if token.RefreshToken, err = openSecret(ctx, table, "refresh_token", where, refreshToken.String); err != nil {
+		return
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = time.Unix(expiresAt.Int64, 0)
+	}
+	return
+}
+
+func (s *SQLStore) SaveToken(ctx context.Context, instance, appName string, token Token) (err error) {
+	if acct := AccountName(ctx); acct != "" {
+		return s.saveAccountToken(ctx, s.DB, instance, appName, acct, token)
+	}
+
+	var accessToken string
+	accessToken, err = s.sealSecret(ctx, s.DB, "apps", "access_token", appRow(instance, appName), token.AccessToken)
+	if err != nil {
+		return
+	}
+
+	var refreshToken, expiresAt any
+	if token.RefreshToken != "" {
+		refreshToken, err = s.sealSecret(ctx, s.DB, "apps", "refresh_token", appRow(instance, appName), token.RefreshToken)
+		if err != nil {
+			return
+		}
+	}
+	if !token.ExpiresAt.IsZero() {
+		expiresAt = token.ExpiresAt.Unix()
+	}
+
+	var stmt string
+	var params []any
+	stmt, params, err = s.Dialect.
+		Update("apps").
+		Set(goqu.Record{
+			"access_token":     accessToken,
+			"refresh_token":    refreshToken,
+			"scopes":           token.Scopes,
+			"token_expires_at": expiresAt,
+		}).
+		Where(goqu.Ex{
+			"instance": instance,
+			"app_name": appName,
+		}).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	_, err = s.DB.ExecContext(ctx, stmt, params...)
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -0,0 +1,140 @@
+package crypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/quells/mastobot/internal/di"
+)
+
+// prefix of values sealed with a Key. Values without it are plaintext.
+const prefix = "enc:v1:"
+
+const keySize = 32
+
+var ErrNoKey = errors.New("value is encrypted; set MASTOBOT_KEY or use --key-file")
+
+// Key for authenticated encryption of secrets at rest with AES-256-GCM. A nil
+// Key stores values in plaintext.
+type Key struct {
+	aead        cipher.AEAD
+	fingerprint string
+}
+
+// ParseKey from 32 random bytes encoded as base64, e.g. the output of
+// `head -c 32 /dev/urandom | base64`.
+func ParseKey(s string) (key *Key, err error) {
+	s = strings.TrimSpace(s)
+
+	var raw []byte
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if raw, err = enc.DecodeString(s); err == nil {
+			break
+		}
+	}
+	if err != nil || len(raw) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes encoded as base64", keySize)
+	}
+
+	var block cipher.Block
+	block, err = aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var aead cipher.AEAD
+	aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, raw)
+	_, _ = mac.Write([]byte("mastobot key fingerprint"))
+
+	key = &Key{
+		aead:        aead,
+		fingerprint: hex.EncodeToString(mac.Sum(nil)[:16]),
+	}
+	return key, nil
+}
+
+// Fingerprint identifying the key without revealing it.
+func (k *Key) Fingerprint() string {
+	if k == nil {
+		return ""
+	}
+	return k.fingerprint
+}
+
+// Seal the plaintext, bound to the additional data, e.g. where the value is
+// stored, which must be passed to Open again. Returns it unchanged if k is nil.
+func (k *Key) Seal(plaintext, additionalData string) (string, error) {
+	if k == nil {
+		return plaintext, nil
+	}
+
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := k.aead.Seal(nonce, nonce, []byte(plaintext), []byte(prefix+additionalData))
+	return prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open a value returned by Seal with the same additional data. Plaintext values
+// are returned unchanged so databases can be encrypted gradually.
+func (k *Key) Open(value, additionalData string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if k == nil {
+		return "", ErrNoKey
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+
+	n := k.aead.NonceSize()
+	if len(sealed) < n {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+
+	var plaintext []byte
+	plaintext, err = k.aead.Open(nil, sealed[:n], sealed[n:], []byte(prefix+additionalData))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value; wrong key, or copied from elsewhere?")
+	}
+
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether the value was returned by Seal.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+type contextKeyType struct{}
+
+var contextKey = contextKeyType{}
+
+func Set(ctx context.Context, key *Key) context.Context {
+	return di.Set(ctx, contextKey, key)
+}
+
+// From returns nil if no key is in the context.
+func From(ctx context.Context) *Key {
+	key, _ := di.Get[contextKeyType, *Key](ctx, contextKey, "*crypt.Key")
+	return key
+}
@@ -0,0 +1,60 @@
+package crypt
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(t *testing.T, b byte) *Key {
+	key, err := ParseKey(base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), keySize))))
+	require.NoError(t, err)
+	return key
+}
+
+func TestSealOpen(t *testing.T) {
+	key := testKey(t, 'a')
+
+	sealed, err := key.Seal("secret", "apps/bot")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(sealed))
+	assert.NotContains(t, sealed, "secret")
+
+	opened, err := key.Open(sealed, "apps/bot")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", opened)
+
+	_, err = testKey(t, 'b').Open(sealed, "apps/bot")
+	assert.Error(t, err)
+
+	_, err = key.Open(sealed, "apps/other")
+	assert.Error(t, err, "bound to the additional data")
+
+	var none *Key
+	_, err = none.Open(sealed, "apps/bot")
+	assert.ErrorIs(t, err, ErrNoKey)
+}
+
+func TestPlaintextPassthrough(t *testing.T) {
+	var none *Key
+	sealed, err := none.Seal("secret", "")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", sealed)
+
+	opened, err := testKey(t, 'a').Open("secret", "")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", opened)
+}
+
+func TestParseKey(t *testing.T) {
+	_, err := ParseKey("too short")
+	assert.Error(t, err)
+
+	a, b := testKey(t, 'a'), testKey(t, 'b')
+	assert.Len(t, a.Fingerprint(), 32)
+	assert.NotEqual(t, a.Fingerprint(), b.Fingerprint())
+	assert.Equal(t, a.Fingerprint(), testKey(t, 'a').Fingerprint())
+}
@@ -0,0 +1,46 @@
+package dbcontext
+
+import (
+	"context"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
+	"github.com/quells/mastobot/internal/di"
+)
+
+const (
+	SQLite   = "sqlite3"
+	Postgres = "postgres"
+)
+
+// Driver for the connection string. Also the name of its SQL dialect.
+func Driver(connStr string) string {
+	if strings.HasPrefix(connStr, "postgres://") || strings.HasPrefix(connStr, "postgresql://") {
+		return Postgres
+	}
+	return SQLite
+}
+
+type dialectKeyType struct{}
+
+var dialectKey = dialectKeyType{}
+
+func SetDialect(ctx context.Context, dialect string) context.Context {
+	return di.Set(ctx, dialectKey, dialect)
+}
+
+// DialectName of the database, sqlite3 if none is set.
+func DialectName(ctx context.Context) string {
+	dialect, err := di.Get[dialectKeyType, string](ctx, dialectKey, "dialect")
+	if err != nil {
+		return SQLite
+	}
+	return dialect
+}
+
+// Dialect to build queries with, sqlite3 if none is set.
+func Dialect(ctx context.Context) goqu.DialectWrapper {
+	return goqu.Dialect(DialectName(ctx))
+}
@@ -0,0 +1,178 @@
+package dbexport
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/quells/mastobot/internal/app"
+	"github.com/quells/mastobot/internal/dbcontext"
+	"github.com/quells/mastobot/internal/dbmigrations"
+	"github.com/rs/zerolog/log"
+)
+
+// FormatVersion of exports written by this package.
+const FormatVersion = 1
+
+// Export of the rows of every table.
+type Export struct {
+	Version       int              `json:"version"`
+	SchemaVersion int64            `json:"schema_version"`
+	ExportedAt    time.Time        `json:"exported_at"`
+	Secrets       bool             `json:"secrets"`
+	Tables        map[string][]Row `json:"tables"`
+}
+
+// Row of a table by column name.
+type Row map[string]any
+
+type table struct {
+	name string
+	key  []string // identifies a row when merging
+
+	// secrets are omitted from exports without secrets. encrypted secrets are
+	// re-encrypted with the key of the database they are imported into.
+	secrets   []string
+	encrypted []string
+
+	// defaults for NOT NULL columns which may be missing from an export
+	defaults Row
+}
+
+// tables exported in the order they are imported. Every table except those of
+// goose and the key fingerprint must be listed.
+var tables = []table{
+	{
+		name:      "apps",
+		key:       []string{"instance", "app_name"},
+		secrets:   append(slices.Clone(app.SecretColumns), "token_expires_at"),
+		encrypted: app.SecretColumns,
+		defaults:  Row{"client_secret": ""},
+	},
+	{
+		name:      "accounts",
+		key:       []string{"instance", "app_name", "acct"},
+		secrets:   append(slices.Clone(app.AccountSecretColumns), "token_expires_at"),
+		encrypted: app.AccountSecretColumns,
+	},
+	{
+		name: "kv",
+		key:  []string{"instance", "app_name", "key"},
+	},
+	{
+		name: "instances",
+		key:  []string{"instance"},
+	},
+	{
+		name: "posts",
+		key:  []string{"instance", "status_id"},
+	},
+}
+
+// Write every table as JSON. Secrets are written as stored, so encrypted
+// secrets can only be imported with the same key.
+func Write(ctx context.Context, w io.Writer, secrets bool) (err error) {
+	var db *sql.DB
+	db, err = dbcontext.From(ctx)
+	if err != nil {
+		return
+	}
+
+	export := Export{
+		Version:    FormatVersion,
+		ExportedAt: time.Now().UTC(),
+		Secrets:    secrets,
+		Tables:     make(map[string][]Row),
+	}
+
+	export.SchemaVersion, err = dbmigrations.Version(db, dbcontext.DialectName(ctx))
+	if err != nil {
+		return
+	}
+
+	for _, t := range tables {
+		var rows []Row
+		rows, err = readTable(ctx, db, t)
+		if err != nil {
+			return fmt.Errorf("exporting %s: %w", t.name, err)
+		}
+
+		if !secrets {
+			for _, row := range rows {
+				for _, col := range t.secrets {
+					delete(row, col)
+				}
+			}
+		}
+
+		if rows == nil {
+			rows = []Row{}
+		}
+		export.Tables[t.name] = rows
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(export)
+}
+
+func readTable(ctx context.Context, db *sql.DB, t table) (result []Row, err error) {
+	var query string
+	query, _, err = dbcontext.Dialect(ctx).
+		From(t.name).
+		Order(orderBy(t.key)...).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(query)
+
+	var rows *sql.Rows
+	rows, err = db.QueryContext(ctx, query)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	var cols []string
+	cols, err = rows.Columns()
+	if err != nil {
+		return
+	}
+
+	for rows.Next() {
+		values := make([]any, len(cols))
+		dest := make([]any, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+
+		row := make(Row, len(cols))
+		for i, col := range cols {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[col] = values[i]
+		}
+		result = append(result, row)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func orderBy(cols []string) (order []exp.OrderedExpression) {
+	for _, col := range cols {
+		order = append(order, goqu.C(col).Asc())
+	}
+	return
+}
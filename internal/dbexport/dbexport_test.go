@@ -0,0 +1,136 @@
+package dbexport
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/quells/mastobot/internal/app"
+	"github.com/quells/mastobot/internal/crypt"
+	"github.com/quells/mastobot/internal/dbcontext"
+	"github.com/quells/mastobot/internal/dbmigrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testContext(t *testing.T) context.Context {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err, "must create database connection")
+	db.SetMaxOpenConns(1)
+	require.NoError(t, dbmigrations.Apply(db, dbcontext.SQLite), "must run database migrations")
+	t.Cleanup(func() { _ = db.Close() })
+
+	ctx := dbcontext.Set(context.Background(), db)
+	return app.Set(ctx, app.NewSQLStore(db, dbcontext.SQLite))
+}
+
+func TestEveryTableExported(t *testing.T) {
+	ctx := testContext(t)
+	db, err := dbcontext.From(ctx)
+	require.NoError(t, err)
+
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name NOT IN ('goose_db_version', 'encryption') ORDER BY name`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		names = append(names, name)
+		assert.True(t, known(name), "table %s must be added to tables", name)
+	}
+	require.NoError(t, rows.Err())
+	assert.Len(t, tables, len(names))
+}
+
+func TestRoundTrip(t *testing.T) {
+	src := testContext(t)
+	require.NoError(t, app.Register(src, "example.com", "bot", "1", "id", "secret", "urn:ietf:wg:oauth:2.0:oob", "read"))
+	require.NoError(t, app.ImportAccessToken(src, "example.com", "bot", "", "", "token", "read"))
+	require.NoError(t, app.SetInt64(src, "example.com", "bot", "count", 3))
+
+	var withSecrets, withoutSecrets bytes.Buffer
+	require.NoError(t, Write(src, &withSecrets, true))
+	require.NoError(t, Write(src, &withoutSecrets, false))
+	assert.NotContains(t, withoutSecrets.String(), `"secret"`)
+
+	dst := testContext(t)
+	_, err := Read(dst, bytes.NewReader(withoutSecrets.Bytes()), ConflictFail)
+	require.NoError(t, err)
+	_, err = app.GetAccessToken(dst, "example.com", "bot")
+	assert.ErrorIs(t, err, app.ErrNoAccessToken)
+
+	_, err = Read(dst, bytes.NewReader(withSecrets.Bytes()), ConflictFail)
+	assert.ErrorContains(t, err, "already exists")
+
+	counts, err := Read(dst, bytes.NewReader(withSecrets.Bytes()), ConflictSkip)
+	require.NoError(t, err)
+	assert.Equal(t, Counts{Table: "apps", Skipped: 1}, counts[0])
+
+	counts, err = Read(dst, bytes.NewReader(withSecrets.Bytes()), ConflictOverwrite)
+	require.NoError(t, err)
+	assert.Equal(t, Counts{Table: "apps", Overwritten: 1}, counts[0])
+
+	token, err := app.GetAccessToken(dst, "example.com", "bot")
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	n, ok, err := app.GetInt64(dst, "example.com", "bot", "count")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), n)
+}
+
+func TestRoundTripEncrypted(t *testing.T) {
+	key, err := crypt.ParseKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{'k'}, 32)))
+	require.NoError(t, err)
+
+	src := crypt.Set(testContext(t), key)
+	require.NoError(t, app.ImportAccessToken(src, "example.com", "bot", "id", "secret", "token", "read"))
+
+	var export bytes.Buffer
+	require.NoError(t, Write(src, &export, true))
+	assert.NotContains(t, export.String(), `"token"`)
+
+	dst := crypt.Set(testContext(t), key)
+	_, err = Read(dst, bytes.NewReader(export.Bytes()), ConflictFail)
+	require.NoError(t, err)
+	token, err := app.GetAccessToken(dst, "example.com", "bot")
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	// secrets are bound to their row
+	moved := strings.ReplaceAll(export.String(), `"bot"`, `"other"`)
+	_, err = Read(crypt.Set(testContext(t), key), strings.NewReader(moved), ConflictFail)
+	assert.ErrorContains(t, err, "failed to decrypt")
+}
+
+func TestReadEncryptedWithoutKey(t *testing.T) {
+	src := testContext(t)
+	require.NoError(t, app.ImportAccessToken(src, "example.com", "bot", "id", "secret", "token", "read"))
+
+	var withSecrets, withoutSecrets bytes.Buffer
+	require.NoError(t, Write(src, &withSecrets, true))
+	require.NoError(t, Write(src, &withoutSecrets, false))
+
+	key, err := crypt.ParseKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{'k'}, 32)))
+	require.NoError(t, err)
+	dst := testContext(t)
+	s, err := app.From(dst)
+	require.NoError(t, err)
+	require.NoError(t, s.(*app.SQLStore).CheckKey(dst, key))
+
+	_, err = Read(dst, bytes.NewReader(withSecrets.Bytes()), ConflictFail)
+	assert.ErrorIs(t, err, app.ErrKeyRequired)
+	exists, err := app.Exists(dst, "example.com", "bot")
+	require.NoError(t, err)
+	assert.False(t, exists, "nothing was imported")
+
+	_, err = Read(dst, bytes.NewReader(withoutSecrets.Bytes()), ConflictFail)
+	assert.NoError(t, err)
+}
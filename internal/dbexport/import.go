@@ -0,0 +1,259 @@
+package dbexport
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/quells/mastobot/internal/app"
+	"github.com/quells/mastobot/internal/crypt"
+	"github.com/quells/mastobot/internal/dbcontext"
+	"github.com/quells/mastobot/internal/dbmigrations"
+	"github.com/rs/zerolog/log"
+)
+
+// Conflict policy for rows which already exist when importing.
+type Conflict string
+
+const (
+	ConflictSkip      Conflict = "skip"      // keep the existing row
+	ConflictOverwrite Conflict = "overwrite" // replace the columns in the export
+	ConflictFail      Conflict = "fail"      // abort the import
+)
+
+func ParseConflict(s string) (Conflict, error) {
+	switch c := Conflict(s); c {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+		return c, nil
+	default:
+		return "", fmt.Errorf("conflict policy must be one of skip, overwrite or fail, got %q", s)
+	}
+}
+
+// Counts of imported rows for a table.
+type Counts struct {
+	Table       string
+	Inserted    int
+	Overwritten int
+	Skipped     int
+}
+
+// Read an export and merge it into the database in a single transaction.
+// Secrets are re-encrypted with the key in the context, if any, which is
+// required if the database is encrypted.
+func Read(ctx context.Context, r io.Reader, conflict Conflict) (counts []Counts, err error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var export Export
+	if err = dec.Decode(&export); err != nil {
+		return nil, fmt.Errorf("reading export: %w", err)
+	}
+	if export.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported export version %d, expected %d", export.Version, FormatVersion)
+	}
+
+	var db *sql.DB
+	db, err = dbcontext.From(ctx)
+	if err != nil {
+		return
+	}
+
+	var version int64
+	version, err = dbmigrations.Version(db, dbcontext.DialectName(ctx))
+	if err != nil {
+		return
+	}
+	if export.SchemaVersion > version {
+		return nil, fmt.Errorf("export has schema version %d, newer than this database's %d; upgrade mastobot first", export.SchemaVersion, version)
+	}
+
+	for name := range export.Tables {
+		if !known(name) {
+			return nil, fmt.Errorf("export contains unknown table %q", name)
+		}
+	}
+	if hasSecrets(export) {
+		if err = app.NewSQLStore(db, dbcontext.DialectName(ctx)).RequireKey(ctx); err != nil {
+			return
+		}
+	}
+
+	var tx *sql.Tx
+	tx, err = db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for _, t := range tables {
+		c := Counts{Table: t.name}
+		for i, row := range export.Tables[t.name] {
+			var result string
+			result, err = importRow(ctx, tx, t, row, conflict)
+			if err != nil {
+				return nil, fmt.Errorf("importing %s row %d: %w", t.name, i+1, err)
+			}
+			switch result {
+			case "inserted":
+				c.Inserted++
+			case "overwritten":
+				c.Overwritten++
+			case "skipped":
+				c.Skipped++
+			}
+		}
+		counts = append(counts, c)
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// hasSecrets reports whether the export has values for encrypted columns.
+func hasSecrets(export Export) bool {
+	for _, t := range tables {
+		for _, row := range export.Tables[t.name] {
+			for _, col := range t.encrypted {
+				if v, ok := row[col].(string); ok && v != "" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func known(name string) bool {
+	for _, t := range tables {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func importRow(ctx context.Context, tx *sql.Tx, t table, row Row, conflict Conflict) (result string, err error) {
+	record := goqu.Record{}
+	for col, value := range row {
+		if value, err = importValue(ctx, t, row, col, value); err != nil {
+			return
+		}
+		record[col] = value
+	}
+
+	where := goqu.Ex{}
+	for _, col := range t.key {
+		value, ok := record[col]
+		if !ok {
+			return "", fmt.Errorf("missing %s", col)
+		}
+		where[col] = value
+	}
+
+	var exists bool
+	exists, err = rowExists(ctx, tx, t, where)
+	if err != nil {
+		return
+	}
+
+	dialect := dbcontext.Dialect(ctx)
+	var stmt string
+	switch {
+	case !exists:
+		for col, value := range t.defaults {
+			if _, ok := record[col]; !ok {
+				record[col] = value
+			}
+		}
+		stmt, _, err = dialect.Insert(t.name).Rows(record).ToSQL()
+		result = "inserted"
+	case conflict == ConflictSkip:
+		return "skipped", nil
+	case conflict == ConflictOverwrite:
+		for col := range where {
+			delete(record, col)
+		}
+		if len(record) == 0 {
+			return "skipped", nil
+		}
+		stmt, _, err = dialect.Update(t.name).Set(record).Where(where).ToSQL()
+		result = "overwritten"
+	default:
+		return "", fmt.Errorf("%s already exists", describe(t, where))
+	}
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	_, err = tx.ExecContext(ctx, stmt)
+	return
+}
+
+// importValue converts JSON numbers to integers and re-encrypts secrets, bound to
+// the row they are imported into as they were to the exported one.
+func importValue(ctx context.Context, t table, row Row, col string, value any) (any, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case string:
+		if !slices.Contains(t.encrypted, col) || v == "" {
+			return v, nil
+		}
+		key := crypt.From(ctx)
+		aad := app.SecretAAD(t.name, col, row)
+		plaintext, err := key.Open(v, aad)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", col, err)
+		}
+		return key.Seal(plaintext, aad)
+	default:
+		return value, nil
+	}
+}
+
+func rowExists(ctx context.Context, tx *sql.Tx, t table, where goqu.Ex) (exists bool, err error) {
+	var query string
+	query, _, err = dbcontext.Dialect(ctx).
+		Select(goqu.COUNT(goqu.Star())).
+		From(t.name).
+		Where(where).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(query)
+
+	var n int
+	err = tx.QueryRowContext(ctx, query).Scan(&n)
+	exists = n > 0
+	return
+}
+
+func describe(t table, where goqu.Ex) string {
+	cols := make([]string, 0, len(where))
+	for col := range where {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	parts := make([]string, 0, len(cols))
+	for _, col := range cols {
+		parts = append(parts, fmt.Sprintf("%s=%v", col, where[col]))
+	}
+	return fmt.Sprintf("%s row with %s", t.name, strings.Join(parts, ", "))
+}
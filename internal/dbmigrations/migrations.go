@@ -3,21 +3,24 @@ package dbmigrations
 import (
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
+	"path"
 
 	"github.com/pressly/goose/v3"
 	"github.com/rs/zerolog/log"
 )
 
-//go:embed migrations/*.sql
+//go:embed migrations/*/*.sql
 var migrations embed.FS
 
-func Apply(db *sql.DB) (err error) {
-	goose.SetLogger(logger{})
-	goose.SetBaseFS(migrations)
+// ErrSchemaTooNew is returned when the database has migrations applied which
+// this build does not know about, e.g. by a newer version of mastobot.
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of mastobot")
 
-	if err = goose.SetDialect("sqlite3"); err != nil {
-		err = fmt.Errorf("goose setting dialect: %w", err)
+// Apply the migrations for the dialect, sqlite3 or postgres.
+func Apply(db *sql.DB, dialect string) (err error) {
+	if err = setDialect(dialect); err != nil {
 		return
 	}
 
@@ -29,7 +32,11 @@ func Apply(db *sql.DB) (err error) {
 	}
 	log.Debug().Int64("version", version).Msgf("goose current version")
 
-	if err = goose.Up(db, "migrations"); err != nil {
+	if err = check(version, dialect); err != nil {
+		return
+	}
+
+	if err = goose.Up(db, dir(dialect)); err != nil {
 		err = fmt.Errorf("goose up: %w", err)
 		return
 	}
@@ -38,19 +45,139 @@ func Apply(db *sql.DB) (err error) {
 }
 
 // Rollback a single version of the database schema.
-func Rollback(db *sql.DB) (err error) {
+func Rollback(db *sql.DB, dialect string) (err error) {
+	if err = setDialect(dialect); err != nil {
+		return
+	}
+
+	if err = goose.Down(db, dir(dialect)); err != nil {
+		err = fmt.Errorf("goose down: %w", err)
+		return
+	}
+
+	return nil
+}
+
+// RollbackTo rolls back every migration newer than version.
+func RollbackTo(db *sql.DB, dialect string, version int64) (err error) {
+	if err = Check(db, dialect); err != nil {
+		return
+	}
+
+	if err = goose.DownTo(db, dir(dialect), version); err != nil {
+		err = fmt.Errorf("goose down to %d: %w", version, err)
+		return
+	}
+
+	return nil
+}
+
+func dir(dialect string) string {
+	return "migrations/" + dialect
+}
+
+func setDialect(dialect string) error {
 	goose.SetLogger(logger{})
 	goose.SetBaseFS(migrations)
 
-	if err = goose.SetDialect("sqlite3"); err != nil {
-		err = fmt.Errorf("goose setting dialect: %w", err)
+	if err := goose.SetDialect(dialect); err != nil {
+		return fmt.Errorf("goose setting dialect: %w", err)
+	}
+	return nil
+}
+
+// Version of the database schema, 0 if no migrations have been applied.
+func Version(db *sql.DB, dialect string) (version int64, err error) {
+	if err = setDialect(dialect); err != nil {
 		return
 	}
 
-	if err = goose.Down(db, "migrations"); err != nil {
-		err = fmt.Errorf("goose down: %w", err)
+	version, err = goose.GetDBVersion(db)
+	if err != nil {
+		err = fmt.Errorf("goose getting db version: %w", err)
 		return
 	}
 
+	return
+}
+
+// Check that the database schema is not newer than the latest migration.
+func Check(db *sql.DB, dialect string) (err error) {
+	var version int64
+	version, err = Version(db, dialect)
+	if err != nil {
+		return
+	}
+
+	return check(version, dialect)
+}
+
+func check(version int64, dialect string) (err error) {
+	var latest int64
+	latest, err = Latest(dialect)
+	if err != nil {
+		return
+	}
+
+	if version > latest {
+		return fmt.Errorf("%w (version %d, latest known %d); upgrade mastobot", ErrSchemaTooNew, version, latest)
+	}
 	return nil
 }
+
+// Migration for a version of the database schema.
+type Migration struct {
+	Version int64
+	Name    string
+	Applied bool
+}
+
+// Latest version of the database schema known to this build.
+func Latest(dialect string) (version int64, err error) {
+	var all goose.Migrations
+	all, err = collect(dialect)
+	if err != nil || len(all) == 0 {
+		return
+	}
+
+	version = all[len(all)-1].Version
+	return
+}
+
+// Status of every known migration, oldest first, and the current version of
+// the database schema.
+func Status(db *sql.DB, dialect string) (status []Migration, version int64, err error) {
+	version, err = Version(db, dialect)
+	if err != nil {
+		return
+	}
+
+	var all goose.Migrations
+	all, err = collect(dialect)
+	if err != nil {
+		return
+	}
+
+	for _, m := range all {
+		status = append(status, Migration{
+			Version: m.Version,
+			Name:    path.Base(m.Source),
+			Applied: m.Version <= version,
+		})
+	}
+	return
+}
+
+func collect(dialect string) (all goose.Migrations, err error) {
+	if err = setDialect(dialect); err != nil {
+		return
+	}
+
+	all, err = goose.CollectMigrations(dir(dialect), 0, goose.MaxVersion)
+	if err != nil {
+		err = fmt.Errorf("goose collecting migrations: %w", err)
+		return
+	}
+
+	return
+}
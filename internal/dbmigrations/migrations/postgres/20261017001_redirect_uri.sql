@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE apps ADD COLUMN redirect_uri TEXT NOT NULL DEFAULT 'urn:ietf:wg:oauth:2.0:oob';
+
+-- +goose Down
+ALTER TABLE apps DROP COLUMN redirect_uri;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE apps ADD COLUMN refresh_token TEXT;
+ALTER TABLE apps ADD COLUMN token_expires_at BIGINT;
+
+-- +goose Down
+ALTER TABLE apps DROP COLUMN token_expires_at;
+ALTER TABLE apps DROP COLUMN refresh_token;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE kv ADD COLUMN expires_at BIGINT;
+
+-- +goose Down
+ALTER TABLE kv DROP COLUMN expires_at;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE apps ADD COLUMN scopes TEXT NOT NULL DEFAULT 'read write';
+
+-- +goose Down
+ALTER TABLE apps DROP COLUMN scopes;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE apps ADD COLUMN otp_secret TEXT;
+
+-- +goose Down
+ALTER TABLE apps DROP COLUMN otp_secret;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE apps ADD COLUMN last_used_at INTEGER;
+
+-- +goose Down
+ALTER TABLE apps DROP COLUMN last_used_at;
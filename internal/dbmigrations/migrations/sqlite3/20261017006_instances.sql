@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE instances (
+    instance       TEXT NOT NULL,
+    info           TEXT NOT NULL,
+    fetched_at     INTEGER NOT NULL,
+
+    UNIQUE (instance)
+);
+
+-- +goose Down
+DROP TABLE instances;
@@ -0,0 +1,7 @@
+-- +goose Up
+CREATE TABLE encryption (
+    fingerprint    TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE encryption;
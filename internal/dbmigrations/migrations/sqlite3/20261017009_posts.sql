@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE posts (
+    instance       TEXT NOT NULL,
+    app_name       TEXT NOT NULL,
+    status_id      TEXT NOT NULL,
+    visibility     TEXT NOT NULL,
+    media_ids      TEXT NOT NULL,
+    content_hash   TEXT NOT NULL,
+    command        TEXT NOT NULL,
+    created_at     INTEGER NOT NULL,
+
+    UNIQUE (instance, status_id)
+);
+
+CREATE INDEX posts_app_created_at ON posts (instance, app_name, created_at);
+
+-- +goose Down
+DROP INDEX posts_app_created_at;
+DROP TABLE posts;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE accounts (
+    instance          TEXT NOT NULL,
+    app_name          TEXT NOT NULL,
+    acct              TEXT NOT NULL,
+    account_id        TEXT NOT NULL DEFAULT '',
+    username          TEXT NOT NULL DEFAULT '',
+    scopes            TEXT NOT NULL DEFAULT '',
+    access_token      TEXT,
+    refresh_token     TEXT,
+    token_expires_at  INTEGER,
+    otp_secret        TEXT,
+    last_used_at      INTEGER,
+
+    UNIQUE (instance, app_name, acct)
+);
+
+ALTER TABLE posts ADD COLUMN account TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN account;
+DROP TABLE accounts;
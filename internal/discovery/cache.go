@@ -0,0 +1,117 @@
+package discovery
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/quells/mastobot/internal/dbcontext"
+	"github.com/rs/zerolog/log"
+)
+
+// Get the capabilities of the instance, discovering them again if the cached
+// copy is older than the TTL. A stale copy is used if discovery fails.
+func Get(ctx context.Context, instance string, ttl time.Duration) (info Instance, err error) {
+	var cached bool
+	info, cached, err = getCached(ctx, instance)
+	if err != nil {
+		return
+	}
+	if cached && time.Since(info.FetchedAt) < ttl {
+		return
+	}
+
+	var discovered Instance
+	discovered, err = Discover(ctx, instance)
+	if err != nil {
+		if cached {
+			log.Warn().Err(err).Time("fetched_at", info.FetchedAt).Msg("using stale instance capabilities")
+			err = nil
+		}
+		return
+	}
+
+	if err = setCached(ctx, instance, discovered); err != nil {
+		log.Warn().Err(err).Msg("failed to cache instance capabilities")
+		err = nil
+	}
+	return discovered, nil
+}
+
+func getCached(ctx context.Context, instance string) (info Instance, ok bool, err error) {
+	var query string
+	var params []any
+	query, params, err = dbcontext.Dialect(ctx).
+		Select("info").
+		From("instances").
+		Where(goqu.Ex{
+			"instance": instance,
+		}).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(query)
+
+	var db *sql.DB
+	db, err = dbcontext.From(ctx)
+	if err != nil {
+		return
+	}
+
+	var encoded string
+	err = db.QueryRowContext(ctx, query, params...).Scan(&encoded)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+		return
+	}
+
+	err = json.Unmarshal([]byte(encoded), &info)
+	if err != nil {
+		return
+	}
+	// limits added since the instance was cached
+	info.setDefaults()
+
+	ok = true
+	return
+}
+
+func setCached(ctx context.Context, instance string, info Instance) (err error) {
+	var encoded []byte
+	encoded, err = json.Marshal(info)
+	if err != nil {
+		return
+	}
+
+	var stmt string
+	var params []any
+	stmt, params, err = dbcontext.Dialect(ctx).
+		Insert("instances").
+		Cols("instance", "info", "fetched_at").
+		Vals(goqu.Vals{instance, string(encoded), info.FetchedAt.Unix()}).
+		OnConflict(
+			goqu.DoUpdate(
+				"instance",
+				goqu.Record{"info": string(encoded), "fetched_at": info.FetchedAt.Unix()},
+			)).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	var db *sql.DB
+	db, err = dbcontext.From(ctx)
+	if err != nil {
+		return
+	}
+
+	_, err = db.ExecContext(ctx, stmt, params...)
+	return
+}
@@ -0,0 +1,276 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Defaults of a vanilla Mastodon instance, used when an instance does not
+// report a limit.
+const (
+	DefaultMaxCharacters       = 500
+	DefaultMaxMediaAttachments = 4
+	DefaultImageSizeLimit      = 16 * 1024 * 1024
+	DefaultVideoSizeLimit      = 99 * 1024 * 1024
+	DefaultMaxPollOptions      = 4
+	DefaultMaxPollOptionChars  = 50
+	DefaultMinPollExpiration   = 5 * 60            // seconds
+	DefaultMaxPollExpiration   = 30 * 24 * 60 * 60 // seconds
+)
+
+// Instance capabilities relevant to posting statuses.
+type Instance struct {
+	Software            string    `json:"software"`
+	Version             string    `json:"version"`
+	MaxCharacters       int       `json:"max_characters"`
+	MaxMediaAttachments int       `json:"max_media_attachments"`
+	ImageSizeLimit      int64     `json:"image_size_limit"` // bytes
+	VideoSizeLimit      int64     `json:"video_size_limit"` // bytes
+	SupportedMIMETypes  []string  `json:"supported_mime_types"`
+	MaxPollOptions      int       `json:"max_poll_options"`
+	MaxPollOptionChars  int       `json:"max_poll_option_chars"`
+	MinPollExpiration   int       `json:"min_poll_expiration"` // seconds
+	MaxPollExpiration   int       `json:"max_poll_expiration"` // seconds
+	FetchedAt           time.Time `json:"fetched_at"`
+}
+
+// SupportsMIMEType reports whether media of the given type may be uploaded.
+// Instances which do not list their supported types are assumed to accept it.
+func (i Instance) SupportsMIMEType(mimeType string) bool {
+	if len(i.SupportedMIMETypes) == 0 {
+		return true
+	}
+	for _, t := range i.SupportedMIMETypes {
+		if strings.EqualFold(t, mimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Defaults of a vanilla Mastodon instance, for when discovery fails.
+func Defaults() Instance {
+	var i Instance
+	i.setDefaults()
+	return i
+}
+
+func (i *Instance) setDefaults() {
+	if i.MaxCharacters == 0 {
+		i.MaxCharacters = DefaultMaxCharacters
+	}
+	if i.MaxMediaAttachments == 0 {
+		i.MaxMediaAttachments = DefaultMaxMediaAttachments
+	}
+	if i.ImageSizeLimit == 0 {
+		i.ImageSizeLimit = DefaultImageSizeLimit
+	}
+	if i.VideoSizeLimit == 0 {
+		i.VideoSizeLimit = DefaultVideoSizeLimit
+	}
+	if i.MaxPollOptions == 0 {
+		i.MaxPollOptions = DefaultMaxPollOptions
+	}
+	if i.MaxPollOptionChars == 0 {
+		i.MaxPollOptionChars = DefaultMaxPollOptionChars
+	}
+	if i.MinPollExpiration == 0 {
+		i.MinPollExpiration = DefaultMinPollExpiration
+	}
+	if i.MaxPollExpiration == 0 {
+		i.MaxPollExpiration = DefaultMaxPollExpiration
+	}
+}
+
+// Discover the capabilities of the instance from NodeInfo and the instance
+// API, bypassing the cache.
+func Discover(ctx context.Context, instance string) (Instance, error) {
+	return discover(ctx, fmt.Sprintf("https://%s", instance))
+}
+
+func discover(ctx context.Context, baseURL string) (info Instance, err error) {
+	software, version, nErr := nodeInfo(ctx, baseURL)
+	if nErr != nil {
+		log.Warn().Err(nErr).Msg("failed to fetch nodeinfo")
+	}
+
+	var apiVersion string
+	apiVersion, err = instanceAPI(ctx, baseURL, &info)
+	if err != nil {
+		return
+	}
+
+	info.Software = software
+	info.Version = version
+	if info.Version == "" {
+		info.Version = apiVersion
+	}
+	info.setDefaults()
+	info.FetchedAt = time.Now()
+	return
+}
+
+type nodeInfoLinks struct {
+	Links []struct {
+		Rel  string `json:"rel"`
+		Href string `json:"href"`
+	} `json:"links"`
+}
+
+type nodeInfoDocument struct {
+	Software struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"software"`
+}
+
+func nodeInfo(ctx context.Context, baseURL string) (software, version string, err error) {
+	var links nodeInfoLinks
+	err = getJSON(ctx, baseURL+"/.well-known/nodeinfo", &links)
+	if err != nil {
+		return
+	}
+
+	var href string
+	for _, link := range links.Links {
+		// prefer the newest schema, listed in any order
+		if strings.HasPrefix(link.Rel, "http://nodeinfo.diaspora.software/ns/schema/2.") && link.Rel > href {
+			href = link.Href
+		}
+	}
+	if href == "" {
+		err = fmt.Errorf("no nodeinfo 2.x document linked")
+		return
+	}
+
+	var doc nodeInfoDocument
+	err = getJSON(ctx, href, &doc)
+	if err != nil {
+		return
+	}
+
+	software = doc.Software.Name
+	version = doc.Software.Version
+	return
+}
+
+type instanceConfiguration struct {
+	Statuses struct {
+		MaxCharacters       int `json:"max_characters"`
+		MaxMediaAttachments int `json:"max_media_attachments"`
+	} `json:"statuses"`
+	MediaAttachments struct {
+		SupportedMIMETypes []string `json:"supported_mime_types"`
+		ImageSizeLimit     int64    `json:"image_size_limit"`
+		VideoSizeLimit     int64    `json:"video_size_limit"`
+	} `json:"media_attachments"`
+	Polls pollLimits `json:"polls"`
+}
+
+type pollLimits struct {
+	MaxOptions             int `json:"max_options"`
+	MaxCharactersPerOption int `json:"max_characters_per_option"`
+	MinExpiration          int `json:"min_expiration"`
+	MaxExpiration          int `json:"max_expiration"`
+}
+
+type instanceResponse struct {
+	Version       string                `json:"version"`
+	Configuration instanceConfiguration `json:"configuration"`
+
+	// Pleroma and Akkoma extensions to /api/v1/instance
+	MaxTootChars int   `json:"max_toot_chars"`
+	UploadLimit  int64 `json:"upload_limit"`
+	PollLimits   struct {
+		MaxOptions     int `json:"max_options"`
+		MaxOptionChars int `json:"max_option_chars"`
+		MinExpiration  int `json:"min_expiration"`
+		MaxExpiration  int `json:"max_expiration"`
+	} `json:"poll_limits"`
+}
+
+// instanceAPI reads limits from /api/v2/instance, falling back to
+// /api/v1/instance for older or non-Mastodon servers.
+func instanceAPI(ctx context.Context, baseURL string, info *Instance) (version string, err error) {
+	var resp instanceResponse
+	err = getJSON(ctx, baseURL+"/api/v2/instance", &resp)
+	if err != nil {
+		log.Debug().Err(err).Msg("falling back to /api/v1/instance")
+		resp = instanceResponse{}
+		err = getJSON(ctx, baseURL+"/api/v1/instance", &resp)
+		if err != nil {
+			return
+		}
+	}
+
+	c := resp.Configuration
+	info.MaxCharacters = c.Statuses.MaxCharacters
+	if info.MaxCharacters == 0 {
+		info.MaxCharacters = resp.MaxTootChars
+	}
+	info.MaxMediaAttachments = c.Statuses.MaxMediaAttachments
+	info.SupportedMIMETypes = c.MediaAttachments.SupportedMIMETypes
+	info.ImageSizeLimit = c.MediaAttachments.ImageSizeLimit
+	info.VideoSizeLimit = c.MediaAttachments.VideoSizeLimit
+	if info.ImageSizeLimit == 0 {
+		info.ImageSizeLimit = resp.UploadLimit
+	}
+	if info.VideoSizeLimit == 0 {
+		info.VideoSizeLimit = resp.UploadLimit
+	}
+
+	polls := c.Polls
+	if polls == (pollLimits{}) {
+		pl := resp.PollLimits
+		polls = pollLimits{
+			MaxOptions:             pl.MaxOptions,
+			MaxCharactersPerOption: pl.MaxOptionChars,
+			MinExpiration:          pl.MinExpiration,
+			MaxExpiration:          pl.MaxExpiration,
+		}
+	}
+	info.MaxPollOptions = polls.MaxOptions
+	info.MaxPollOptionChars = polls.MaxCharactersPerOption
+	info.MinPollExpiration = polls.MinExpiration
+	info.MaxPollExpiration = polls.MaxExpiration
+
+	version = resp.Version
+	return
+}
+
+func getJSON(ctx context.Context, u string, v any) (err error) {
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/json")
+
+	var resp *http.Response
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+
+	var respBody []byte
+	respBody, err = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("got status %d from %s", resp.StatusCode, u)
+		return
+	}
+
+	err = json.Unmarshal(respBody, v)
+	return
+}
@@ -0,0 +1,69 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverV2(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/.well-known/nodeinfo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"links":[
+			{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.0","href":"%[1]s/nodeinfo/2.0"},
+			{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.1","href":"%[1]s/nodeinfo/2.1"}
+		]}`, srv.URL)
+	})
+	mux.HandleFunc("/nodeinfo/2.1", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"version":"2.1","software":{"name":"gotosocial","version":"0.17.0"}}`)
+	})
+	mux.HandleFunc("/api/v2/instance", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"version":"4.2.0","configuration":{
+			"statuses":{"max_characters":5000,"max_media_attachments":6},
+			"media_attachments":{"supported_mime_types":["image/jpeg","image/png"],"image_size_limit":41943040,"video_size_limit":41943040},
+			"polls":{"max_options":6,"max_characters_per_option":100,"min_expiration":300,"max_expiration":604800}
+		}}`)
+	})
+
+	info, err := discover(context.Background(), srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "gotosocial", info.Software)
+	assert.Equal(t, "0.17.0", info.Version)
+	assert.Equal(t, 5000, info.MaxCharacters)
+	assert.Equal(t, 6, info.MaxMediaAttachments)
+	assert.Equal(t, int64(41943040), info.ImageSizeLimit)
+	assert.True(t, info.SupportsMIMEType("image/jpeg"))
+	assert.False(t, info.SupportsMIMEType("video/mp4"))
+	assert.Equal(t, 6, info.MaxPollOptions)
+	assert.Equal(t, 100, info.MaxPollOptionChars)
+	assert.Equal(t, 604800, info.MaxPollExpiration)
+}
+
+func TestDiscoverV1Fallback(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/api/v1/instance", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"version":"2.7.2 (compatible; Pleroma 2.5.0)","max_toot_chars":2000,"upload_limit":16000000,"poll_limits":{"max_options":20,"max_option_chars":200,"min_expiration":0,"max_expiration":31536000}}`)
+	})
+
+	info, err := discover(context.Background(), srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "", info.Software, "nodeinfo is unavailable")
+	assert.Equal(t, "2.7.2 (compatible; Pleroma 2.5.0)", info.Version)
+	assert.Equal(t, 2000, info.MaxCharacters)
+	assert.Equal(t, DefaultMaxMediaAttachments, info.MaxMediaAttachments)
+	assert.Equal(t, int64(16000000), info.ImageSizeLimit)
+	assert.True(t, info.SupportsMIMEType("image/png"), "unlisted types are assumed to be supported")
+	assert.Equal(t, 20, info.MaxPollOptions)
+	assert.Equal(t, DefaultMinPollExpiration, info.MinPollExpiration, "unreported limits are defaulted")
+}
@@ -0,0 +1,152 @@
+package ledger
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/quells/mastobot/internal/dbcontext"
+	"github.com/rs/zerolog/log"
+)
+
+// Post submitted by mastobot.
+type Post struct {
+	Instance    string    `json:"instance"`
+	AppName     string    `json:"app_name"`
+	Account     string    `json:"account,omitempty"` // empty for the application's own token
+	StatusID    string    `json:"status_id"`
+	Visibility  string    `json:"visibility"`
+	MediaIDs    []string  `json:"media_ids"`
+	ContentHash string    `json:"content_hash"` // see ContentHash
+	Command     string    `json:"command"`      // e.g. "mastobot app toot"
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ContentHash of the text and spoiler of a status, so repeated posts can be
+// identified without storing their content.
+func ContentHash(text, spoiler string) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(spoiler))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(text))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Record a submitted post. A status already recorded, e.g. returned again for a
+// retried request with the same idempotency key, is kept as first recorded.
+func Record(ctx context.Context, post Post) (err error) {
+	mediaIDs := post.MediaIDs
+	if mediaIDs == nil {
+		mediaIDs = []string{}
+	}
+
+	var encoded []byte
+	encoded, err = json.Marshal(mediaIDs)
+	if err != nil {
+		return
+	}
+
+	var stmt string
+	var params []any
+	stmt, params, err = dbcontext.Dialect(ctx).
+		Insert("posts").
+		Cols("instance", "app_name", "account", "status_id", "visibility", "media_ids", "content_hash", "command", "created_at").
+		Vals(goqu.Vals{post.Instance, post.AppName, post.Account, post.StatusID, post.Visibility, string(encoded), post.ContentHash, post.Command, post.CreatedAt.Unix()}).
+		OnConflict(goqu.DoNothing()).
+		ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(stmt)
+
+	var db *sql.DB
+	db, err = dbcontext.From(ctx)
+	if err != nil {
+		return
+	}
+
+	_, err = db.ExecContext(ctx, stmt, params...)
+	return
+}
+
+// Query for posts. Zero values match everything.
+type Query struct {
+	Instance string
+	AppName  string
+	Account  string
+	Since    time.Time // inclusive
+	Until    time.Time // exclusive
+	Limit    int
+}
+
+// List posts matching the query, newest first.
+func List(ctx context.Context, q Query) (posts []Post, err error) {
+	where := goqu.Ex{}
+	if q.Instance != "" {
+		where["instance"] = q.Instance
+	}
+	if q.AppName != "" {
+		where["app_name"] = q.AppName
+	}
+	if q.Account != "" {
+		where["account"] = q.Account
+	}
+
+	ds := dbcontext.Dialect(ctx).
+		Select("instance", "app_name", "account", "status_id", "visibility", "media_ids", "content_hash", "command", "created_at").
+		From("posts").
+		Where(where).
+		Order(goqu.C("created_at").Desc(), goqu.C("status_id").Desc())
+	if !q.Since.IsZero() {
+		ds = ds.Where(goqu.C("created_at").Gte(q.Since.Unix()))
+	}
+	if !q.Until.IsZero() {
+		ds = ds.Where(goqu.C("created_at").Lt(q.Until.Unix()))
+	}
+	if q.Limit > 0 {
+		ds = ds.Limit(uint(q.Limit))
+	}
+
+	var query string
+	var params []any
+	query, params, err = ds.ToSQL()
+	if err != nil {
+		return
+	}
+	log.Debug().Msg(query)
+
+	var db *sql.DB
+	db, err = dbcontext.From(ctx)
+	if err != nil {
+		return
+	}
+
+	var rows *sql.Rows
+	rows, err = db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var post Post
+		var mediaIDs string
+		var createdAt int64
+		err = rows.Scan(&post.Instance, &post.AppName, &post.Account, &post.StatusID, &post.Visibility, &mediaIDs, &post.ContentHash, &post.Command, &createdAt)
+		if err != nil {
+			return
+		}
+		if err = json.Unmarshal([]byte(mediaIDs), &post.MediaIDs); err != nil {
+			return
+		}
+		post.CreatedAt = time.Unix(createdAt, 0)
+		posts = append(posts, post)
+	}
+
+	err = rows.Err()
+	return
+}
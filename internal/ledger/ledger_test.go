@@ -0,0 +1,66 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/quells/mastobot/internal/dbcontext"
+	"github.com/quells/mastobot/internal/dbmigrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordList(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err, "must create database connection")
+	db.SetMaxOpenConns(1)
+	require.NoError(t, dbmigrations.Apply(db, "sqlite3"), "must run database migrations")
+	ctx := dbcontext.Set(context.Background(), db)
+
+	start := time.Unix(1700000000, 0)
+	for i, p := range []Post{
+		{Instance: "example.com", AppName: "bot", StatusID: "1", Visibility: "public"},
+		{Instance: "example.com", AppName: "bot", StatusID: "2", Visibility: "private", MediaIDs: []string{"10", "11"}},
+		{Instance: "example.com", AppName: "other", Account: "alt", StatusID: "3", Visibility: "public"},
+	} {
+		p.ContentHash = ContentHash("hello", "")
+		p.Command = "mastobot app toot"
+		p.CreatedAt = start.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, Record(ctx, p))
+	}
+
+	posts, err := List(ctx, Query{AppName: "bot"})
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.Equal(t, "2", posts[0].StatusID, "newest first")
+	assert.Equal(t, []string{"10", "11"}, posts[0].MediaIDs)
+	assert.Equal(t, []string{}, posts[1].MediaIDs)
+	assert.Equal(t, start, posts[1].CreatedAt)
+
+	posts, err = List(ctx, Query{Since: start.Add(time.Hour), Until: start.Add(2 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "2", posts[0].StatusID)
+
+	posts, err = List(ctx, Query{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "3", posts[0].StatusID)
+	assert.Equal(t, "alt", posts[0].Account)
+
+	posts, err = List(ctx, Query{Account: "alt"})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+
+	// an idempotent re-run returns the status already posted
+	require.NoError(t, Record(ctx, Post{Instance: "example.com", AppName: "bot", StatusID: "1", Visibility: "public", CreatedAt: start.Add(5 * time.Hour)}))
+	posts, err = List(ctx, Query{AppName: "bot"})
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.Equal(t, start, posts[1].CreatedAt, "the first record is kept")
+
+	assert.NotEqual(t, ContentHash("a", "b"), ContentHash("ab", ""))
+}
@@ -1,23 +1,33 @@
 package oauth2
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
+	"time"
 
 	"github.com/quells/mastobot/internal/app"
 	"github.com/rs/zerolog/log"
 )
 
 const (
-	oauthOOB   = "urn:ietf:wg:oauth:2.0:oob"
+	OOB        = "urn:ietf:wg:oauth:2.0:oob"
 	appWebsite = "https://github.com/quells/mastobot"
 )
 
-func RegisterApp(ctx context.Context, instance, appName string) (err error) {
+// RegisterApp with the instance. The redirectURI is either OOB, where the
+// instance displays the authorization code to the user, or a loopback URI from
+// LoopbackRedirectURI. Access tokens may only be requested for the given
+// scopes or a subset of them. An existing application is only registered again
+// if forced, which removes its access token.
+func RegisterApp(ctx context.Context, instance, appName, redirectURI, scopes string, force bool) (err error) {
 	var c *client
 	c, err = newClient(ctx)
 	if err != nil {
@@ -29,18 +39,22 @@ func RegisterApp(ctx context.Context, instance, appName string) (err error) {
 	if err != nil {
 		return err
 	}
-	if alreadyExists {
+	if alreadyExists && !force {
 		err = fmt.Errorf("%q is already registered with %q", appName, instance)
 		return err
 	}
 
 	var resp registerAppResponse
-	resp, err = c.registerApp(instance, appName)
+	resp, err = c.registerApp(instance, appName, redirectURI, scopes)
 	if err != nil {
 		return err
 	}
 
-	err = app.Register(ctx, instance, appName, resp.AppID, resp.ClientID, resp.ClientSecret)
+	if alreadyExists {
+		err = app.Reregister(ctx, instance, appName, resp.AppID, resp.ClientID, resp.ClientSecret, redirectURI, scopes)
+	} else {
+		err = app.Register(ctx, instance, appName, resp.AppID, resp.ClientID, resp.ClientSecret, redirectURI, scopes)
+	}
 	if err != nil {
 		return err
 	}
@@ -48,29 +62,65 @@ func RegisterApp(ctx context.Context, instance, appName string) (err error) {
 	return nil
 }
 
-func GetAccessToken(ctx context.Context, instance, appName, email, password string) (err error) {
+// Credentials to sign in as the user.
+type Credentials struct {
+	Email    string
+	Password string
+	OTP      string // two-factor code; generated from the stored TOTP secret if empty
+}
+
+// GetAccessToken by signing in as the user. If scopes is empty, the scopes the
+// application currently holds are requested.
+func GetAccessToken(ctx context.Context, instance, appName string, creds Credentials, scopes string) (err error) {
 	var c *client
 	c, err = newClient(ctx)
 	if err != nil {
 		return err
 	}
 
+	scopes, err = scopesOrDefault(ctx, instance, appName, scopes)
+	if err != nil {
+		return err
+	}
+
 	var clientID, clientSecret string
 	clientID, clientSecret, err = app.GetClientSecrets(ctx, instance, appName)
 	if err != nil {
 		return err
 	}
 
-	err = c.getOAuthCookies(instance, clientID)
+	var redirectURI string
+	redirectURI, err = app.GetRedirectURI(ctx, instance, appName)
+	if err != nil {
+		return err
+	}
+
+	err = c.getOAuthCookies(instance, authorizeQuery(clientID, redirectURI, scopes))
 	if err != nil {
 		return err
 	}
 
 	var signinLocation string
-	signinLocation, err = c.signin(instance, email, password)
+	var otpForm []byte
+	signinLocation, otpForm, err = c.signin(instance, creds.Email, creds.Password)
 	if err != nil {
 		return err
 	}
+	if otpForm != nil {
+		log.Debug().Msg("sign-in requires two-factor code")
+		otp := creds.OTP
+		if otp == "" {
+			otp, err = otpCode(ctx, instance, appName, time.Now())
+			if err != nil {
+				return err
+			}
+		}
+
+		signinLocation, err = c.signinOTP(instance, otpForm, otp)
+		if err != nil {
+			return err
+		}
+	}
 	log.Debug().Str("location", signinLocation).Msg("sign-in location")
 
 	var code string
@@ -80,14 +130,101 @@ func GetAccessToken(ctx context.Context, instance, appName, email, password stri
 	}
 	log.Debug().Str("code", code).Msg("sign-in code")
 
+	var token oauthTokenResponse
+	token, err = c.getOAuthToken(instance, tokenGrant{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURI:  redirectURI,
+		scopes:       scopes,
+		code:         code,
+	})
+	if err != nil {
+		return err
+	}
+
+	return saveToken(ctx, instance, appName, token, scopes)
+}
+
+// AuthorizeURL for a user to visit in a browser to grant the application access
+// to their account. The instance displays a code to pass to ExchangeCode with
+// the same scopes.
+func AuthorizeURL(ctx context.Context, instance, appName, scopes string) (u string, err error) {
+	var clientID string
+	clientID, _, err = app.GetClientSecrets(ctx, instance, appName)
+	if err != nil {
+		return "", err
+	}
+
+	scopes, err = scopesOrDefault(ctx, instance, appName, scopes)
+	if err != nil {
+		return "", err
+	}
+
+	return authorizeURL(instance, authorizeQuery(clientID, OOB, scopes)), nil
+}
+
+// ExchangeCode obtained through AuthorizeURL for an access token.
+func ExchangeCode(ctx context.Context, instance, appName, scopes, code string) (err error) {
+	var c *client
+	c, err = newClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	scopes, err = scopesOrDefault(ctx, instance, appName, scopes)
+	if err != nil {
+		return err
+	}
+
+	var clientID, clientSecret string
+	clientID, clientSecret, err = app.GetClientSecrets(ctx, instance, appName)
+	if err != nil {
+		return err
+	}
+
+	var token oauthTokenResponse
+	token, err = c.getOAuthToken(instance, tokenGrant{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURI:  OOB,
+		scopes:       scopes,
+		code:         code,
+	})
+	if err != nil {
+		return err
+	}
+
+	return saveToken(ctx, instance, appName, token, scopes)
+}
+
+func RevokeAccessToken(ctx context.Context, instance, appName string) (err error) {
+	var c *client
+	c, err = newClient(ctx)
+	if err != nil {
+		return err
+	}
+
 	var token string
-	token, err = c.getOAuthToken(instance, clientID, clientSecret, code)
+	token, err = app.GetAccessToken(ctx, instance, appName)
+	if err != nil {
+		if errors.Is(err, app.ErrNoAccessToken) {
+			err = fmt.Errorf("%q on %q has no access token to revoke", appName, instance)
+		}
+		return err
+	}
+
+	var clientID, clientSecret string
+	clientID, clientSecret, err = app.GetClientSecrets(ctx, instance, appName)
+	if err != nil {
+		return err
+	}
+
+	err = c.revokeOAuthToken(instance, clientID, clientSecret, token)
 	if err != nil {
 		return err
 	}
-	log.Debug().Str("token", token).Msg("access token")
 
-	err = app.UpdateAccessToken(ctx, instance, appName, token)
+	err = app.ClearAccessToken(ctx, instance, appName)
 	if err != nil {
 		return err
 	}
@@ -95,19 +232,46 @@ func GetAccessToken(ctx context.Context, instance, appName, email, password stri
 	return nil
 }
 
+func scopesOrDefault(ctx context.Context, instance, appName, scopes string) (string, error) {
+	if scopes != "" {
+		return scopes, nil
+	}
+	return app.GetScopes(ctx, instance, appName)
+}
+
+// saveToken and the scopes the instance granted, falling back to the requested
+// scopes for instances which do not report them.
+func saveToken(ctx context.Context, instance, appName string, resp oauthTokenResponse, requested string) error {
+	log.Debug().Str("token", resp.Token).Str("scope", resp.Scope).Msg("access token")
+	scopes := resp.Scope
+	if scopes == "" {
+		scopes = requested
+	}
+
+	token := app.Token{
+		AccessToken:  resp.Token,
+		RefreshToken: resp.RefreshToken,
+		Scopes:       ParseScopes(scopes).String(),
+	}
+	if resp.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return app.SaveToken(ctx, instance, appName, token)
+}
+
 type registerAppResponse struct {
 	AppID        string `json:"id"`
 	ClientID     string `json:"client_id"`
 	ClientSecret string `json:"client_secret"`
 }
 
-func (c *client) registerApp(instance, appName string) (result registerAppResponse, err error) {
+func (c *client) registerApp(instance, appName, redirectURI, scopes string) (result registerAppResponse, err error) {
 	c.followRedirects()
 	u := fmt.Sprintf("https://%s/api/v1/apps", instance)
 	f := make(url.Values)
 	f.Set("client_name", appName)
-	f.Set("redirect_uris", oauthOOB)
-	f.Set("scopes", "read write")
+	f.Set("redirect_uris", redirectURI)
+	f.Set("scopes", scopes)
 	f.Set("website", appWebsite)
 
 	var resp *http.Response
@@ -134,16 +298,23 @@ func (c *client) registerApp(instance, appName string) (result registerAppRespon
 	return result, err
 }
 
-func (c *client) getOAuthCookies(instance, clientID string) (err error) {
-	c.ignoreRedirects()
-
+func authorizeQuery(clientID, redirectURI, scopes string) url.Values {
 	q := make(url.Values)
 	q.Set("response_type", "code")
 	q.Set("client_id", clientID)
-	q.Set("redirect_uri", oauthOOB)
-	q.Set("scope", "read write")
+	q.Set("redirect_uri", redirectURI)
+	q.Set("scope", scopes)
+	return q
+}
+
+func authorizeURL(instance string, q url.Values) string {
+	return fmt.Sprintf("https://%s/oauth/authorize?%s", instance, q.Encode())
+}
 
-	u := fmt.Sprintf("https://%s/oauth/authorize?%s", instance, q.Encode())
+func (c *client) getOAuthCookies(instance string, q url.Values) (err error) {
+	c.ignoreRedirects()
+
+	u := authorizeURL(instance, q)
 	var req *http.Request
 	req, err = http.NewRequest(http.MethodGet, u, nil)
 	if err != nil {
@@ -166,7 +337,9 @@ func (c *client) getOAuthCookies(instance, clientID string) (err error) {
 	return nil
 }
 
-func (c *client) signin(instance string, email, password string) (location string, err error) {
+// signin returns the page with the two-factor challenge form instead of a
+// location if the account requires it.
+func (c *client) signin(instance string, email, password string) (location string, otpForm []byte, err error) {
 	c.ignoreRedirects()
 
 	u := fmt.Sprintf("https://%s/auth/sign_in", instance)
@@ -174,6 +347,38 @@ func (c *client) signin(instance string, email, password string) (location strin
 	f.Set("username", email)
 	f.Set("password", password)
 
+	var resp *http.Response
+	resp, err = c.PostForm(u, f)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if resp.StatusCode != http.StatusFound {
+		respBody, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusOK && bytes.Contains(respBody, []byte("otp_attempt")) {
+			return "", respBody, nil
+		}
+		log.Debug().Msg(string(respBody))
+		return "", nil, fmt.Errorf("got status %d while signing in", resp.StatusCode)
+	}
+
+	return resp.Header.Get("Location"), nil, nil
+}
+
+var authenticityToken = regexp.MustCompile(`name="authenticity_token" value="([^"]*)"`)
+
+// signinOTP submits a two-factor code to the challenge form returned by signin.
+func (c *client) signinOTP(instance string, otpForm []byte, otp string) (location string, err error) {
+	c.ignoreRedirects()
+
+	u := fmt.Sprintf("https://%s/auth/sign_in", instance)
+	f := make(url.Values)
+	f.Set("user[otp_attempt]", otp)
+	if m := authenticityToken.FindSubmatch(otpForm); m != nil {
+		f.Set("authenticity_token", html.UnescapeString(string(m[1])))
+	}
+
 	var resp *http.Response
 	resp, err = c.PostForm(u, f)
 	if err != nil {
@@ -184,7 +389,7 @@ func (c *client) signin(instance string, email, password string) (location strin
 		respBody, _ := io.ReadAll(resp.Body)
 		_ = resp.Body.Close()
 		log.Debug().Msg(string(respBody))
-		return "", fmt.Errorf("got status %d while signing in", resp.StatusCode)
+		return "", fmt.Errorf("got status %d while submitting two-factor code", resp.StatusCode)
 	}
 
 	return resp.Header.Get("Location"), nil
@@ -218,47 +423,88 @@ func (c *client) getOAuthCode(instance, location string) (code string, err error
 }
 
 type oauthTokenResponse struct {
-	Token string `json:"access_token"`
-	Type  string `json:"token_type"`
+	Token        string `json:"access_token"`
+	Type         string `json:"token_type"`
+	Scope        string `json:"scope"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // seconds
+}
+
+type tokenGrant struct {
+	clientID     string
+	clientSecret string
+	redirectURI  string
+	scopes       string
+	code         string
+	codeVerifier string // only set when the code was requested with a PKCE code challenge
+	refreshToken string // replaces the code when refreshing an expired access token
 }
 
-func (c *client) getOAuthToken(instance, clientID, clientSecret, code string) (token string, err error) {
+func (c *client) getOAuthToken(instance string, g tokenGrant) (tokenResp oauthTokenResponse, err error) {
 	c.followRedirects()
 
 	u := fmt.Sprintf("https://%s/oauth/token", instance)
 	f := make(url.Values)
-	f.Set("grant_type", "authorization_code")
-	f.Set("redirect_uri", oauthOOB)
-	f.Set("scope", "read write")
-	f.Set("client_id", clientID)
-	f.Set("client_secret", clientSecret)
-	f.Set("code", code)
+	if g.refreshToken != "" {
+		f.Set("grant_type", "refresh_token")
+		f.Set("refresh_token", g.refreshToken)
+	} else {
+		f.Set("grant_type", "authorization_code")
+		f.Set("redirect_uri", g.redirectURI)
+		f.Set("code", g.code)
+	}
+	f.Set("scope", g.scopes)
+	f.Set("client_id", g.clientID)
+	f.Set("client_secret", g.clientSecret)
+	if g.codeVerifier != "" {
+		f.Set("code_verifier", g.codeVerifier)
+	}
 
 	var resp *http.Response
 	resp, err = http.DefaultClient.PostForm(u, f)
 	if err != nil {
-		return "", err
+		return tokenResp, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
 		_ = resp.Body.Close()
 		log.Debug().Msg(string(respBody))
-		return "", fmt.Errorf("got status %d while getting oauth2 token", resp.StatusCode)
+		return tokenResp, fmt.Errorf("got status %d while getting oauth2 token", resp.StatusCode)
 	}
 
 	var respBody []byte
 	respBody, err = io.ReadAll(resp.Body)
 	_ = resp.Body.Close()
 	if err != nil {
-		return "", err
+		return tokenResp, err
 	}
 
-	var tokenResp oauthTokenResponse
 	err = json.Unmarshal(respBody, &tokenResp)
+	return tokenResp, err
+}
+
+func (c *client) revokeOAuthToken(instance, clientID, clientSecret, token string) (err error) {
+	c.followRedirects()
+
+	u := fmt.Sprintf("https://%s/oauth/revoke", instance)
+	f := make(url.Values)
+	f.Set("client_id", clientID)
+	f.Set("client_secret", clientSecret)
+	f.Set("token", token)
+
+	var resp *http.Response
+	resp, err = c.PostForm(u, f)
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	respBody, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Debug().Msg(string(respBody))
+		return fmt.Errorf("got status %d while revoking oauth2 token", resp.StatusCode)
 	}
 
-	return tokenResp.Token, nil
+	return nil
 }
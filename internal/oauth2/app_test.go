@@ -0,0 +1,88 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/quells/mastobot/internal/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const otpSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+const otpPage = `<form action="/auth/sign_in" method="post">
+<input type="hidden" name="authenticity_token" value="a+b&amp;c">
+<input type="text" name="user[otp_attempt]" id="user_otp_attempt">
+</form>`
+
+// signinInstance accepts the credentials, asking for a two-factor code first if
+// requireOTP is set, and issues an access token for the code it redirects to.
+func signinInstance(t *testing.T, requireOTP bool) string {
+	key, err := decodeOTPSecret(otpSecret)
+	require.NoError(t, err)
+
+	return testInstance(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /oauth/authorize":
+			http.SetCookie(w, &http.Cookie{Name: "_session_id", Value: "session", Path: "/"})
+			http.Redirect(w, r, "/auth/sign_in", http.StatusSeeOther)
+
+		case "POST /auth/sign_in":
+			_, err := r.Cookie("_session_id")
+			assert.NoError(t, err)
+
+			if otp := r.PostFormValue("user[otp_attempt]"); otp != "" {
+				now := time.Now()
+				assert.Contains(t, []string{totp(key, now, totpDigits), totp(key, now.Add(-totpPeriod), totpDigits)}, otp)
+				assert.Equal(t, "a+b&c", r.PostFormValue("authenticity_token"))
+			} else {
+				assert.Equal(t, "bot@example.com", r.PostFormValue("username"))
+				assert.Equal(t, "hunter2", r.PostFormValue("password"))
+				if requireOTP {
+					_, _ = w.Write([]byte(otpPage))
+					return
+				}
+			}
+			http.Redirect(w, r, "/oauth/authorize?client_id=id", http.StatusFound)
+
+		case "POST /oauth/authorize":
+			http.Redirect(w, r, "/oauth/authorize/native?code=code", http.StatusFound)
+
+		case "POST /oauth/token":
+			assert.Equal(t, "code", r.PostFormValue("code"))
+			_, _ = w.Write([]byte(`{"access_token":"access","token_type":"Bearer","scope":"read"}`))
+
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func TestGetAccessToken(t *testing.T) {
+	creds := Credentials{Email: "bot@example.com", Password: "hunter2"}
+
+	for _, requireOTP := range []bool{false, true} {
+		instance := signinInstance(t, requireOTP)
+		ctx := app.Set(context.Background(), app.NewMemoryStore())
+		require.NoError(t, app.Register(ctx, instance, "bot", "1", "id", "secret", OOB, "read"))
+		require.NoError(t, SetOTPSecret(ctx, instance, "bot", otpSecret))
+
+		require.NoError(t, GetAccessToken(ctx, instance, "bot", creds, ""), "two-factor: %v", requireOTP)
+		token, err := app.GetAccessToken(ctx, instance, "bot")
+		require.NoError(t, err)
+		assert.Equal(t, "access", token)
+	}
+}
+
+func TestGetAccessTokenWithoutOTPSecret(t *testing.T) {
+	instance := signinInstance(t, true)
+	ctx := app.Set(context.Background(), app.NewMemoryStore())
+	require.NoError(t, app.Register(ctx, instance, "bot", "1", "id", "secret", OOB, "read"))
+
+	err := GetAccessToken(ctx, instance, "bot", Credentials{Email: "bot@example.com", Password: "hunter2"}, "")
+	assert.ErrorContains(t, err, "account requires a two-factor code")
+}
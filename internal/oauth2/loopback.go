@@ -0,0 +1,201 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/quells/mastobot/internal/app"
+	"github.com/rs/zerolog/log"
+)
+
+// LoopbackRedirectURI registered for a listener on 127.0.0.1. It has no port,
+// so the instance accepts any port at login, which is then taken from those
+// currently free (RFC 8252 section 7.3).
+const LoopbackRedirectURI = "http://127.0.0.1/callback"
+
+// IsLoopback reports whether the redirect URI points at a listener on this host.
+func IsLoopback(redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "http" && u.Hostname() == "127.0.0.1"
+}
+
+// LoopbackLogin listens on the application's loopback redirect URI and calls
+// open with the URL the user must visit to authorize the application. The
+// authorization code sent to the listener is exchanged for an access token
+// using PKCE. Waits until the code arrives or the context is done. If scopes is
+// empty, the scopes the application currently holds are requested.
+func LoopbackLogin(ctx context.Context, instance, appName, scopes string, open func(authorizeURL string)) (err error) {
+	scopes, err = scopesOrDefault(ctx, instance, appName, scopes)
+	if err != nil {
+		return err
+	}
+
+	var clientID, clientSecret string
+	clientID, clientSecret, err = app.GetClientSecrets(ctx, instance, appName)
+	if err != nil {
+		return err
+	}
+
+	var redirectURI string
+	redirectURI, err = app.GetRedirectURI(ctx, instance, appName)
+	if err != nil {
+		return err
+	}
+	if !IsLoopback(redirectURI) {
+		return fmt.Errorf("%q on %q is not registered with a loopback redirect URI", appName, instance)
+	}
+
+	var verifier, state string
+	if verifier, err = randomString(32); err != nil {
+		return err
+	}
+	if state, err = randomString(16); err != nil {
+		return err
+	}
+
+	var code string
+	code, redirectURI, err = waitForCode(ctx, redirectURI, state, func(redirectURI string) {
+		q := authorizeQuery(clientID, redirectURI, scopes)
+		q.Set("state", state)
+		q.Set("code_challenge", codeChallenge(verifier))
+		q.Set("code_challenge_method", "S256")
+		open(authorizeURL(instance, q))
+	})
+	if err != nil {
+		return err
+	}
+	log.Debug().Str("code", code).Msg("loopback code")
+
+	var c *client
+	c, err = newClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	var token oauthTokenResponse
+	token, err = c.getOAuthToken(instance, tokenGrant{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURI:  redirectURI,
+		scopes:       scopes,
+		code:         code,
+		codeVerifier: verifier,
+	})
+	if err != nil {
+		return err
+	}
+
+	return saveToken(ctx, instance, appName, token, scopes)
+}
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// waitForCode on a listener for the registered redirect URI. Unless it has a
+// port, any free one is used, and ready is called with the redirect URI
+// including it.
+func waitForCode(ctx context.Context, registeredURI, state string, ready func(redirectURI string)) (code, redirectURI string, err error) {
+	var u *url.URL
+	u, err = url.Parse(registeredURI)
+	if err != nil {
+		return "", "", err
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	results := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			http.Error(w, "unexpected state", http.StatusBadRequest)
+			return
+		}
+
+		var result callbackResult
+		if e := q.Get("error"); e != "" {
+			if desc := q.Get("error_description"); desc != "" {
+				e = desc
+			}
+			result.err = fmt.Errorf("authorization failed: %s", e)
+			_, _ = fmt.Fprintln(w, "Authorization failed. You may close this window.")
+		} else {
+			result.code = q.Get("code")
+			_, _ = fmt.Fprintln(w, "Authorization complete. You may close this window.")
+		}
+
+		select {
+		case results <- result:
+		default:
+		}
+	})
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "0")
+	}
+
+	var l net.Listener
+	l, err = net.Listen("tcp", host)
+	if err != nil {
+		return "", "", err
+	}
+	u.Host = l.Addr().String()
+	redirectURI = u.String()
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if sErr := srv.Serve(l); sErr != nil && !errors.Is(sErr, http.ErrServerClosed) {
+			log.Error().Err(sErr).Msg("loopback listener failed")
+		}
+	}()
+	defer func() {
+		_ = srv.Close()
+	}()
+
+	ready(redirectURI)
+
+	select {
+	case result := <-results:
+		if result.err != nil {
+			return "", "", result.err
+		}
+		if result.code == "" {
+			return "", "", fmt.Errorf("no authorization code in redirect")
+		}
+		return result.code, redirectURI, nil
+	case <-ctx.Done():
+		return "", "", fmt.Errorf("waiting for authorization: %w", ctx.Err())
+	}
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,99 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/quells/mastobot/internal/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testInstance serves the handler over TLS in place of an instance, returning
+// its host.
+func testInstance(t *testing.T, handler http.HandlerFunc) string {
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+
+	transport := http.DefaultTransport
+	http.DefaultTransport = srv.Client().Transport
+	t.Cleanup(func() { http.DefaultTransport = transport })
+
+	return srv.Listener.Addr().String()
+}
+
+func TestLoopbackLogin(t *testing.T) {
+	var challenge string
+	var form url.Values
+	instance := testInstance(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		form = r.PostForm
+		assert.Equal(t, "/oauth/token", r.URL.Path)
+		_, _ = w.Write([]byte(`{"access_token":"access","token_type":"Bearer","scope":"read"}`))
+	})
+
+	ctx := app.Set(context.Background(), app.NewMemoryStore())
+	require.NoError(t, app.Register(ctx, instance, "bot", "1", "id", "secret", LoopbackRedirectURI, "read"))
+
+	var redirectURI string
+	err := LoopbackLogin(ctx, instance, "bot", "", func(authorizeURL string) {
+		u, err := url.Parse(authorizeURL)
+		require.NoError(t, err)
+		q := u.Query()
+		redirectURI = q.Get("redirect_uri")
+		redirect, err := url.Parse(redirectURI)
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1", redirect.Hostname())
+		assert.NotEmpty(t, redirect.Port(), "listening on a free port")
+		assert.Equal(t, "/callback", redirect.Path)
+		assert.Equal(t, "read", q.Get("scope"))
+		assert.Equal(t, "S256", q.Get("code_challenge_method"))
+		challenge = q.Get("code_challenge")
+
+		resp, err := http.Get(redirectURI + "?" + url.Values{"state": {"forged"}, "code": {"stolen"}}.Encode())
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp, err = http.Get(redirectURI + "?" + url.Values{"state": {q.Get("state")}, "code": {"code"}}.Encode())
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "authorization_code", form.Get("grant_type"))
+	assert.Equal(t, "code", form.Get("code"), "not the code sent with the wrong state")
+	assert.Equal(t, redirectURI, form.Get("redirect_uri"))
+	require.NotEmpty(t, form.Get("code_verifier"))
+	assert.Equal(t, challenge, codeChallenge(form.Get("code_verifier")))
+
+	token, err := app.GetAccessToken(ctx, instance, "bot")
+	require.NoError(t, err)
+	assert.Equal(t, "access", token)
+}
+
+func TestWaitForCodeDenied(t *testing.T) {
+	_, _, err := waitForCode(context.Background(), LoopbackRedirectURI, "state", func(redirectURI string) {
+		resp, err := http.Get(redirectURI + "?state=state&error=access_denied&error_description=The+user+denied+access")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	})
+	assert.EqualError(t, err, "authorization failed: The user denied access")
+}
+
+func TestWaitForCodeTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var redirectURI string
+	_, _, err := waitForCode(ctx, LoopbackRedirectURI, "state", func(uri string) { redirectURI = uri })
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the listener is closed again
+	_, err = http.Get(redirectURI)
+	assert.Error(t, err)
+}
@@ -0,0 +1,87 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quells/mastobot/internal/app"
+	"github.com/rs/zerolog/log"
+)
+
+// refreshMargin before an access token expires when it is refreshed ahead of
+// use, so it does not expire mid-request.
+const refreshMargin = time.Minute
+
+var ErrNoRefreshToken = errors.New("no refresh token stored")
+
+// AccessToken for the application, refreshed first if it is about to expire.
+func AccessToken(ctx context.Context, instance, appName string) (string, error) {
+	token, err := app.GetToken(ctx, instance, appName)
+	if err != nil {
+		return "", err
+	}
+
+	if token.ExpiresAt.IsZero() || time.Until(token.ExpiresAt) > refreshMargin {
+		return token.AccessToken, nil
+	}
+	if token.RefreshToken == "" {
+		log.Warn().Time("expires_at", token.ExpiresAt).Msg("access token expires and cannot be refreshed")
+		return token.AccessToken, nil
+	}
+
+	log.Info().Time("expires_at", token.ExpiresAt).Msg("refreshing access token")
+	return refresh(ctx, instance, appName, token)
+}
+
+// RefreshAccessToken using the stored refresh token, e.g. after the instance
+// rejected the access token. Returns ErrNoRefreshToken if the instance did not
+// issue one.
+func RefreshAccessToken(ctx context.Context, instance, appName string) (string, error) {
+	token, err := app.GetToken(ctx, instance, appName)
+	if err != nil {
+		return "", err
+	}
+	if token.RefreshToken == "" {
+		return "", ErrNoRefreshToken
+	}
+
+	return refresh(ctx, instance, appName, token)
+}
+
+func refresh(ctx context.Context, instance, appName string, token app.Token) (accessToken string, err error) {
+	var c *client
+	c, err = newClient(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var clientID, clientSecret string
+	clientID, clientSecret, err = app.GetClientSecrets(ctx, instance, appName)
+	if err != nil {
+		return "", err
+	}
+
+	var resp oauthTokenResponse
+	resp, err = c.getOAuthToken(instance, tokenGrant{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       token.Scopes,
+		refreshToken: token.RefreshToken,
+	})
+	if err != nil {
+		return "", fmt.Errorf("refreshing access token: %w", err)
+	}
+	// refresh tokens may be reused if the instance does not rotate them
+	if resp.RefreshToken == "" {
+		resp.RefreshToken = token.RefreshToken
+	}
+
+	err = saveToken(ctx, instance, appName, resp, token.Scopes)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Token, nil
+}
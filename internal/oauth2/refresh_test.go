@@ -0,0 +1,96 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/quells/mastobot/internal/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessTokenNotExpiring(t *testing.T) {
+	ctx := app.Set(context.Background(), app.NewMemoryStore())
+	require.NoError(t, app.Register(ctx, "example.com", "bot", "1", "id", "secret", OOB, "read"))
+
+	_, err := AccessToken(ctx, "example.com", "bot")
+	assert.ErrorIs(t, err, app.ErrNoAccessToken)
+
+	require.NoError(t, app.SaveToken(ctx, "example.com", "bot", app.Token{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		Scopes:       "read",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}))
+	token, err := AccessToken(ctx, "example.com", "bot")
+	require.NoError(t, err)
+	assert.Equal(t, "access", token, "not refreshed until it is about to expire")
+
+	require.NoError(t, app.SaveToken(ctx, "example.com", "bot", app.Token{
+		AccessToken: "access",
+		Scopes:      "read",
+		ExpiresAt:   time.Now().Add(-time.Hour),
+	}))
+	token, err = AccessToken(ctx, "example.com", "bot")
+	require.NoError(t, err)
+	assert.Equal(t, "access", token, "used as is without a refresh token")
+
+	_, err = RefreshAccessToken(ctx, "example.com", "bot")
+	assert.ErrorIs(t, err, ErrNoRefreshToken)
+}
+
+func TestAccessTokenExpired(t *testing.T) {
+	var form url.Values
+	refreshToken := ""
+	instance := testInstance(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		form = r.PostForm
+		assert.Equal(t, "/oauth/token", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "fresh",
+			"token_type":    "Bearer",
+			"scope":         "read write",
+			"refresh_token": refreshToken,
+			"expires_in":    3600,
+		})
+	})
+
+	ctx := app.Set(context.Background(), app.NewMemoryStore())
+	require.NoError(t, app.Register(ctx, instance, "bot", "1", "id", "secret", OOB, "read write"))
+	require.NoError(t, app.SaveToken(ctx, instance, "bot", app.Token{
+		AccessToken:  "stale",
+		RefreshToken: "refresh",
+		Scopes:       "read write",
+		ExpiresAt:    time.Now().Add(30 * time.Second),
+	}))
+
+	token, err := AccessToken(ctx, instance, "bot")
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", token)
+	assert.Equal(t, "refresh_token", form.Get("grant_type"))
+	assert.Equal(t, "refresh", form.Get("refresh_token"))
+	assert.Equal(t, "id", form.Get("client_id"))
+	assert.Equal(t, "secret", form.Get("client_secret"))
+	assert.Empty(t, form.Get("code"))
+
+	stored, err := app.GetToken(ctx, instance, "bot")
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", stored.AccessToken)
+	assert.Equal(t, "refresh", stored.RefreshToken, "kept when the instance does not rotate it")
+	assert.WithinDuration(t, time.Now().Add(time.Hour), stored.ExpiresAt, time.Minute)
+
+	refreshToken = "rotated"
+	token, err = RefreshAccessToken(ctx, instance, "bot")
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", token)
+	assert.Equal(t, "refresh", form.Get("refresh_token"))
+
+	stored, err = app.GetToken(ctx, instance, "bot")
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", stored.RefreshToken)
+}
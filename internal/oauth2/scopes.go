@@ -0,0 +1,69 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/quells/mastobot/internal/app"
+)
+
+// Scopes granted to an access token, such as "read" or "write:statuses".
+type Scopes []string
+
+func ParseScopes(s string) Scopes {
+	return strings.Fields(s)
+}
+
+func (s Scopes) String() string {
+	return strings.Join(s, " ")
+}
+
+// Covers reports whether the required scope is granted directly or through a
+// broader scope, e.g. "write" covers "write:statuses".
+func (s Scopes) Covers(required string) bool {
+	for _, granted := range s {
+		if granted == required || strings.HasPrefix(required, granted+":") {
+			return true
+		}
+	}
+	// verifying credentials was allowed with read:accounts before the
+	// profile scope was introduced
+	if required == "profile" {
+		return s.Covers("read:accounts")
+	}
+	return false
+}
+
+// Missing from the granted scopes.
+func (s Scopes) Missing(required ...string) (missing Scopes) {
+	for _, r := range required {
+		if !s.Covers(r) {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// GrantedScopes for the application's current access token.
+func GrantedScopes(ctx context.Context, instance, appName string) (Scopes, error) {
+	scopes, err := app.GetScopes(ctx, instance, appName)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScopes(scopes), nil
+}
+
+// RequireScopes fails if the application's access token was not granted all of
+// the required scopes. Returns the granted scopes otherwise.
+func RequireScopes(ctx context.Context, instance, appName string, required ...string) (Scopes, error) {
+	granted, err := GrantedScopes(ctx, instance, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	if missing := granted.Missing(required...); len(missing) > 0 {
+		return nil, fmt.Errorf("%q on %q is missing scopes %q (has %q); renew the token with --scopes", appName, instance, missing.String(), granted.String())
+	}
+	return granted, nil
+}
@@ -0,0 +1,53 @@
+package oauth2
+
+import (
+	"context"
+	"testing"
+
+	"github.com/quells/mastobot/internal/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopesCovers(t *testing.T) {
+	tests := []struct {
+		granted  string
+		required string
+		covers   bool
+	}{
+		{"read write", "write:statuses", true},
+		{"read write", "follow", false},
+		{"write:statuses write:media", "write:statuses", true},
+		{"write:statuses write:media", "write:media", true},
+		{"write:statuses write:media", "read:statuses", false},
+		{"write:statuses", "write", false},
+		{"writer", "write:statuses", false},
+		{"read:accounts", "profile", true},
+		{"read", "profile", true},
+		{"profile", "profile", true},
+		{"write", "profile", false},
+	}
+
+	for _, tt := range tests {
+		got := ParseScopes(tt.granted).Covers(tt.required)
+		assert.Equal(t, tt.covers, got, "%q covers %q", tt.granted, tt.required)
+	}
+}
+
+func TestScopesMissing(t *testing.T) {
+	granted := ParseScopes("read:statuses  write:statuses")
+	assert.Empty(t, granted.Missing("read:statuses", "write:statuses"))
+	assert.Equal(t, Scopes{"write:media", "profile"}, granted.Missing("write:media", "write:statuses", "profile"))
+}
+
+func TestRequireScopes(t *testing.T) {
+	ctx := app.Set(context.Background(), app.NewMemoryStore())
+	require.NoError(t, app.ImportAccessToken(ctx, "example.com", "bot", "", "", "token", "write:statuses"))
+
+	granted, err := RequireScopes(ctx, "example.com", "bot", "write:statuses")
+	require.NoError(t, err)
+	assert.True(t, granted.Covers("write:statuses"))
+
+	_, err = RequireScopes(ctx, "example.com", "bot", "write:statuses", "write:media")
+	assert.ErrorContains(t, err, "write:media")
+}
@@ -0,0 +1,85 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/quells/mastobot/internal/app"
+)
+
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+)
+
+// SetOTPSecret stores the base32 TOTP secret shown when enabling two-factor
+// authentication, so codes can be generated while renewing access tokens.
+func SetOTPSecret(ctx context.Context, instance, appName, secret string) error {
+	secret = normalizeOTPSecret(secret)
+	if _, err := decodeOTPSecret(secret); err != nil {
+		return err
+	}
+	return app.SetOTPSecret(ctx, instance, appName, secret)
+}
+
+// otpCode from the stored TOTP secret.
+func otpCode(ctx context.Context, instance, appName string, now time.Time) (code string, err error) {
+	var secret string
+	secret, err = app.GetOTPSecret(ctx, instance, appName)
+	if err != nil {
+		return "", err
+	}
+	if secret == "" {
+		return "", fmt.Errorf("account requires a two-factor code; pass --otp or store a TOTP secret with `app otp set`")
+	}
+
+	var key []byte
+	key, err = decodeOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return totp(key, now, totpDigits), nil
+}
+
+func normalizeOTPSecret(secret string) string {
+	secret = strings.ReplaceAll(secret, " ", "")
+	secret = strings.TrimRight(secret, "=")
+	return strings.ToUpper(secret)
+}
+
+func decodeOTPSecret(secret string) ([]byte, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalizeOTPSecret(secret))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("invalid TOTP secret: empty")
+	}
+	return key, nil
+}
+
+// totp as described by RFC 6238 using HMAC-SHA1.
+func totp(key []byte, t time.Time, digits int) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(t.Unix()/int64(totpPeriod/time.Second)))
+
+	mac := hmac.New(sha1.New, key)
+	_, _ = mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
@@ -0,0 +1,45 @@
+package oauth2
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 Appendix B, SHA1
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, totp(key, time.Unix(tt.unix, 0), 8), "time %d", tt.unix)
+	}
+}
+
+func TestDecodeOTPSecret(t *testing.T) {
+	encoded := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	key, err := decodeOTPSecret("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("12345678901234567890"), key)
+
+	key, err = decodeOTPSecret(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("12345678901234567890"), key)
+
+	_, err = decodeOTPSecret("not base32!")
+	assert.Error(t, err)
+}
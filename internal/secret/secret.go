@@ -0,0 +1,77 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var ErrNotProvided = errors.New("secret not provided")
+
+// Source of a secret which should not be passed as a command line argument.
+// Checked in order: file, stdin, environment variable, then an interactive
+// prompt without echo if stdin is a terminal. An empty file or stdin is an
+// error rather than an empty secret.
+type Source struct {
+	Name  string // used when prompting, e.g. "Password"
+	File  string
+	Stdin bool
+	Env   string
+}
+
+func (s Source) Read() (value string, err error) {
+	if s.File != "" {
+		var b []byte
+		b, err = os.ReadFile(s.File)
+		if err != nil {
+			return "", err
+		}
+		if value = trimNewline(string(b)); value == "" {
+			return "", fmt.Errorf("%w: %s is empty", ErrNotProvided, s.File)
+		}
+		return value, nil
+	}
+
+	if s.Stdin {
+		var b []byte
+		b, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		if value = trimNewline(string(b)); value == "" {
+			return "", fmt.Errorf("%w: stdin is empty", ErrNotProvided)
+		}
+		return value, nil
+	}
+
+	if s.Env != "" {
+		if value = os.Getenv(s.Env); value != "" {
+			return value, nil
+		}
+	}
+
+	fd := int(os.Stdin.Fd())
+	if s.Name != "" && term.IsTerminal(fd) {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: ", s.Name)
+		var b []byte
+		b, err = term.ReadPassword(fd)
+		_, _ = fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if len(b) > 0 {
+			return string(b), nil
+		}
+	}
+
+	return "", ErrNotProvided
+}
+
+func trimNewline(s string) string {
+	s = strings.TrimSuffix(s, "\n")
+	return strings.TrimSuffix(s, "\r")
+}
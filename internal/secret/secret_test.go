@@ -0,0 +1,48 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(path, []byte("from file\n"), 0o600))
+	t.Setenv("MASTOBOT_TEST_SECRET", "from env")
+
+	value, err := Source{File: path, Env: "MASTOBOT_TEST_SECRET"}.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "from file", value, "file takes precedence over environment")
+
+	value, err = Source{Env: "MASTOBOT_TEST_SECRET"}.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "from env", value)
+
+	_, err = Source{Env: "MASTOBOT_TEST_UNSET"}.Read()
+	assert.ErrorIs(t, err, ErrNotProvided)
+}
+
+func TestReadEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(path, []byte("\n"), 0o600))
+	t.Setenv("MASTOBOT_TEST_SECRET", "from env")
+
+	_, err := Source{File: path, Env: "MASTOBOT_TEST_SECRET"}.Read()
+	assert.ErrorIs(t, err, ErrNotProvided, "not an empty secret, nor one from elsewhere")
+	assert.ErrorContains(t, err, path)
+
+	stdin, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = stdin.Close() }()
+	orig := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = orig }()
+
+	_, err = Source{Stdin: true, Env: "MASTOBOT_TEST_SECRET"}.Read()
+	assert.ErrorIs(t, err, ErrNotProvided)
+	assert.ErrorContains(t, err, "stdin is empty")
+}
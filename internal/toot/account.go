@@ -2,63 +2,70 @@ package toot
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/quells/mastobot/internal/app"
 )
 
-type verifyCredentialsResponse struct {
-	AccountID string `json:"id"`
+// ErrWrongAccount is returned by VerifyCredentials if the access token belongs
+// to another account than the one selected with app.SetAccount.
+var ErrWrongAccount = errors.New("token belongs to another account")
+
+// Account the access token belongs to.
+type Account struct {
+	ID             string `json:"id"`
+	Username       string `json:"username"`
+	Acct           string `json:"acct"`
+	DisplayName    string `json:"display_name"`
+	URL            string `json:"url"`
+	Bot            bool   `json:"bot"`
+	FollowersCount int    `json:"followers_count"`
+	FollowingCount int    `json:"following_count"`
+	StatusesCount  int    `json:"statuses_count"`
 }
 
-func VerifyCredentials(ctx context.Context, instance, appName string) (accountID string, err error) {
-	var accessToken string
-	accessToken, err = app.GetAccessToken(ctx, instance, appName)
-	if err != nil {
-		return
-	}
-
-	u := fmt.Sprintf("https://%s/api/v1/accounts/verify_credentials", instance)
+// Is reports whether this is the account acct, with or without a leading @
+// or the domain of the instance, which local accounts are reported without.
+func (a Account) Is(acct, instance string) bool {
+	return strings.EqualFold(app.NormalizeAcct(acct, instance), app.NormalizeAcct(a.Acct, instance))
+}
 
-	var req *http.Request
-	req, err = http.NewRequest(http.MethodGet, u, nil)
-	if err != nil {
-		return
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
-	req.Header.Set("Accept", "application/json")
-	req = req.WithContext(ctx)
+// Application the access token was issued to.
+type Application struct {
+	Name    string   `json:"name"`
+	Website string   `json:"website"`
+	Scopes  []string `json:"scopes"` // only reported by Mastodon 4.3 and later
+}
 
-	var resp *http.Response
-	resp, err = http.DefaultClient.Do(req)
+// VerifyCredentials of the access token and return the account it belongs to.
+// Requires the profile or read:accounts scope. If the client was created with
+// NewClient for an account selected with app.SetAccount, the token must belong
+// to it and its ID and username are stored.
+func (c *Client) VerifyCredentials(ctx context.Context) (account Account, err error) {
+	err = c.request(ctx, http.MethodGet, "/api/v1/accounts/verify_credentials", nil, nil, nil, &account)
 	if err != nil {
 		return
 	}
 
-	if resp.StatusCode == http.StatusUnauthorized {
-		err = fmt.Errorf("invalid token")
+	acct := app.AccountName(ctx)
+	if c.appName == "" || acct == "" {
 		return
 	}
-
-	var respBody []byte
-	respBody, err = io.ReadAll(resp.Body)
-	_ = resp.Body.Close()
-	if err != nil {
-		return
-	}
-
-	var response verifyCredentialsResponse
-	err = json.Unmarshal(respBody, &response)
-	if err != nil {
-		err = fmt.Errorf("got status %d: %s %w", resp.StatusCode, string(respBody), err)
+	if !account.Is(acct, c.instance) {
+		err = fmt.Errorf("%w: token for account %q belongs to %q", ErrWrongAccount, acct, account.Acct)
 		return
 	}
+	err = app.SaveAccountInfo(ctx, c.instance, c.appName, acct, account.ID, account.Username)
+	return
+}
 
-	accountID = response.AccountID
+// VerifyApplication the access token was issued to.
+func (c *Client) VerifyApplication(ctx context.Context) (application Application, err error) {
+	err = c.request(ctx, http.MethodGet, "/api/v1/apps/verify_credentials", nil, nil, nil, &application)
 	return
 }
 
@@ -88,48 +95,9 @@ func (l ListStatuses) QueryParams() url.Values {
 	return v
 }
 
-// ForAccount ID ListStatuses matching parameters sorted newest to oldest.
-func (l ListStatuses) ForAccount(ctx context.Context, instance, appName, accountID string) (statuses []Status, err error) {
-	var accessToken string
-	accessToken, err = app.GetAccessToken(ctx, instance, appName)
-	if err != nil {
-		return
-	}
-
-	u := fmt.Sprintf("https://%s/api/v1/accounts/%s/statuses?%s", instance, accountID, l.QueryParams().Encode())
-
-	var req *http.Request
-	req, err = http.NewRequest(http.MethodGet, u, nil)
-	if err != nil {
-		return
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
-	req.Header.Set("Accept", "application/json")
-	req = req.WithContext(ctx)
-
-	var resp *http.Response
-	resp, err = http.DefaultClient.Do(req)
-	if err != nil {
-		return
-	}
-
-	if resp.StatusCode == http.StatusUnauthorized {
-		err = fmt.Errorf("invalid token")
-		return
-	}
-
-	var respBody []byte
-	respBody, err = io.ReadAll(resp.Body)
-	_ = resp.Body.Close()
-	if err != nil {
-		return
-	}
-
-	err = json.Unmarshal(respBody, &statuses)
-	if err != nil {
-		err = fmt.Errorf("got status %d: %s %w", resp.StatusCode, string(respBody), err)
-		return
-	}
-
+// AccountStatuses matching the parameters, sorted newest to oldest.
+func (c *Client) AccountStatuses(ctx context.Context, accountID string, l ListStatuses) (statuses []Status, err error) {
+	path := "/api/v1/accounts/" + url.PathEscape(accountID) + "/statuses"
+	err = c.request(ctx, http.MethodGet, path, l.QueryParams(), nil, nil, &statuses)
 	return
 }
@@ -0,0 +1,258 @@
+package toot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/quells/mastobot/internal/app"
+	"github.com/quells/mastobot/internal/oauth2"
+	"github.com/rs/zerolog"
+)
+
+// Client of the Mastodon API, acting with a single access token. Not safe for
+// concurrent use.
+type Client struct {
+	BaseURL   string       // e.g. https://mastodon.social
+	Token     string       // sent as a bearer token, if any
+	HTTP      *http.Client // http.DefaultClient if nil
+	UserAgent string
+	Logger    zerolog.Logger
+
+	// Refresh returns a new access token after the instance rejected Token, or
+	// an empty token if it cannot be refreshed. Optional.
+	Refresh func(ctx context.Context) (string, error)
+
+	// RateLimits last reported by the instance for each family of endpoints.
+	// Requests wait for the reset of their family's, or the global one, once
+	// it is exhausted.
+	RateLimits map[RateLimitFamily]RateLimit
+
+	// application the token is stored for, if created with NewClient
+	instance, appName string
+	used              bool // recorded with app.MarkUsed
+
+	sleep func(ctx context.Context, d time.Duration) error // sleepContext if nil
+}
+
+// NewClient for the instance with the access token of the application, or of
+// the account selected with app.SetAccount. The token is refreshed first if it
+// is about to expire, and again if the instance rejects it. Its use is recorded
+// once the instance accepts a request.
+func NewClient(ctx context.Context, instance, appName string) (c *Client, err error) {
+	var token string
+	token, err = oauth2.AccessToken(ctx, instance, appName)
+	if err != nil {
+		return
+	}
+
+	c = &Client{
+		BaseURL: "https://" + instance,
+		Token:   token,
+		Refresh: func(ctx context.Context) (string, error) {
+			token, err := oauth2.RefreshAccessToken(ctx, instance, appName)
+			if errors.Is(err, oauth2.ErrNoRefreshToken) {
+				return "", nil
+			}
+			return token, err
+		},
+		instance: instance,
+		appName:  appName,
+	}
+	return
+}
+
+// markUsed records the first successful request with the token of an
+// application created with NewClient.
+func (c *Client) markUsed(ctx context.Context) {
+	if c.appName == "" || c.used {
+		return
+	}
+	c.used = true
+	if err := app.MarkUsed(ctx, c.instance, c.appName, time.Now()); err != nil {
+		c.Logger.Warn().Err(err).Msg("failed to record application use")
+	}
+}
+
+// Error response from the API.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("got status %d: %s", e.StatusCode, e.Message)
+}
+
+func newError(statusCode int, body []byte) *Error {
+	var resp struct {
+		Error string `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &resp) == nil && resp.Error != "" {
+		message = resp.Error
+	}
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return &Error{StatusCode: statusCode, Message: message}
+}
+
+// request the path of the API and decode the JSON response into v, unless it
+// is nil. A rejected token is refreshed and the request sent once more. Once
+// the rate limit is exhausted, requests wait for its reset. 429 responses, and
+// 5xx responses to requests which are safe to repeat, are retried with backoff,
+// as long as the context's deadline allows.
+func (c *Client) request(ctx context.Context, method, path string, query url.Values, header http.Header, body []byte, v any) (err error) {
+	family := rateLimitFamily(method, path)
+	refreshed := false
+	for retries := 0; ; {
+		if reset := c.rateLimitReset(family, time.Now()); !reset.IsZero() {
+			wait := time.Until(reset) + resetMargin
+			c.Logger.Info().Dur("wait", wait).Str("family", string(family)).Msg("rate limit exhausted, waiting for reset")
+			if err = c.wait(ctx, wait); err != nil {
+				return
+			}
+		}
+
+		var resp *http.Response
+		resp, err = c.send(ctx, method, path, query, header, body)
+		if err != nil {
+			return
+		}
+
+		var respBody []byte
+		respBody, err = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return
+		}
+		if rl, ok := parseRateLimit(resp.Header); ok {
+			if c.RateLimits == nil {
+				c.RateLimits = make(map[RateLimitFamily]RateLimit)
+			}
+			c.RateLimits[family] = rl
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && c.Refresh != nil && !refreshed {
+			refreshed = true
+			var token string
+			token, err = c.Refresh(ctx)
+			if err != nil {
+				return
+			}
+			if token != "" {
+				c.Token = token
+				c.Logger.Info().Msg("retrying with refreshed access token")
+				continue
+			}
+		}
+
+		if retryable(resp.StatusCode, method, header) && retries < maxRetries {
+			wait := backoff(retries)
+			if resp.StatusCode == http.StatusTooManyRequests && !c.rateLimitReset(family, time.Now()).IsZero() {
+				// waited for at the top of the loop instead
+				wait = 0
+			}
+			retries++
+			c.Logger.Warn().
+				Int("status", resp.StatusCode).
+				Dur("wait", wait).
+				Int("retry", retries).
+				Msg("retrying request")
+			if err = c.wait(ctx, wait); err != nil {
+				return
+			}
+			continue
+		}
+
+		if resp.StatusCode/100 != 2 {
+			return newError(resp.StatusCode, respBody)
+		}
+		c.markUsed(ctx)
+		if v == nil {
+			return nil
+		}
+
+		if err = json.Unmarshal(respBody, v); err != nil {
+			return fmt.Errorf("decoding response to %s %s: %w", method, path, err)
+		}
+		return nil
+	}
+}
+
+// rateLimitReset of the family, or of the global rate limit, whichever is
+// later, if exhausted. Zero if requests of the family may be sent now.
+func (c *Client) rateLimitReset(family RateLimitFamily, now time.Time) (reset time.Time) {
+	for _, f := range []RateLimitFamily{RateLimitGlobal, family} {
+		if rl := c.RateLimits[f]; rl.exhausted(now) && rl.Reset.After(reset) {
+			reset = rl.Reset
+		}
+	}
+	return
+}
+
+func (c *Client) wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	if c.sleep != nil {
+		return c.sleep(ctx, d)
+	}
+	return sleepContext(ctx, d)
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, header http.Header, body []byte) (resp *http.Response, err error) {
+	u := strings.TrimSuffix(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, values := range header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	start := time.Now()
+	resp, err = httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	c.Logger.Debug().
+		Str("method", method).
+		Str("path", path).
+		Int("status", resp.StatusCode).
+		Dur("duration", time.Since(start)).
+		Msg("api request")
+	return
+}
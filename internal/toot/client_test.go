@@ -0,0 +1,524 @@
+package toot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quells/mastobot/internal/app"
+	"github.com/quells/mastobot/internal/discovery"
+	"github.com/quells/mastobot/internal/oauth2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmitStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/v1/statuses", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "mastobot-test", r.Header.Get("User-Agent"))
+		assert.Equal(t, IdempotencyKey("bot", "1"), r.Header.Get("Idempotency-Key"))
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "hello", r.PostForm.Get("status"))
+		assert.Equal(t, "unlisted", r.PostForm.Get("visibility"))
+		assert.Equal(t, []string{"1", "2"}, r.PostForm["media_ids[]"])
+		assert.Equal(t, "de", r.PostForm.Get("language"))
+		assert.Equal(t, "text/markdown", r.PostForm.Get("content_type"))
+		_, _ = fmt.Fprint(w, `{"id":"103254962155278888"}`)
+	}))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL, Token: "token", UserAgent: "mastobot-test"}
+	id, err := c.SubmitStatus(context.Background(), Status{
+		Text:       "hello",
+		Visibility: VisibilityUnlisted,
+		MediaIDs:   []string{"1", "2"},
+		Language:   "de",
+
+		ContentType:    ContentTypeMarkdown,
+		IdempotencyKey: IdempotencyKey("bot", "1"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "103254962155278888", id)
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	assert.Equal(t, IdempotencyKey("bot", "1"), IdempotencyKey("bot", "1"))
+	assert.NotEqual(t, IdempotencyKey("bot", "1"), IdempotencyKey("bot", "2"))
+	assert.NotEqual(t, IdempotencyKey("bot1", ""), IdempotencyKey("bot", "1"), "parts are separated")
+	assert.Len(t, IdempotencyKey(), 64)
+}
+
+func TestValidateLanguage(t *testing.T) {
+	limits := discovery.Defaults()
+	for _, lang := range []string{"", "en", "cnr", "zh-TW"} {
+		assert.NoError(t, Status{Text: "hi", Language: lang}.Validate(limits), lang)
+	}
+	for _, lang := range []string{"english", "EN", "en_US", "e"} {
+		assert.Error(t, Status{Text: "hi", Language: lang}.Validate(limits), lang)
+	}
+	assert.NoError(t, Status{Text: "*hi*", ContentType: ContentTypeMarkdown}.Validate(limits))
+	assert.Error(t, Status{Text: "hi", ContentType: "text/rtf"}.Validate(limits))
+}
+
+func TestRefreshRejectedToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = fmt.Fprint(w, `{"error":"The access token is invalid"}`)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	refreshed := 0
+	c := &Client{
+		BaseURL: srv.URL,
+		Token:   "stale",
+		Refresh: func(ctx context.Context) (string, error) {
+			refreshed++
+			return "fresh", nil
+		},
+	}
+	require.NoError(t, c.DeleteStatus(context.Background(), "1"))
+	assert.Equal(t, 1, refreshed)
+	assert.Equal(t, "fresh", c.Token)
+
+	// without a refresh token the rejection is returned as is
+	c = &Client{
+		BaseURL: srv.URL,
+		Token:   "stale",
+		Refresh: func(ctx context.Context) (string, error) { return "", nil },
+	}
+	err := c.DeleteStatus(context.Background(), "1")
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, "The access token is invalid", apiErr.Message)
+}
+
+func TestNewClientRefresh(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/token" {
+			assert.Equal(t, "refresh_token", r.FormValue("grant_type"))
+			assert.Equal(t, "refresh", r.FormValue("refresh_token"))
+			_, _ = fmt.Fprint(w, `{"access_token":"fresh","token_type":"Bearer","scope":"read write"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	transport := http.DefaultTransport
+	http.DefaultTransport = srv.Client().Transport
+	defer func() { http.DefaultTransport = transport }()
+
+	instance := srv.Listener.Addr().String()
+	ctx := app.Set(context.Background(), app.NewMemoryStore())
+	require.NoError(t, app.Register(ctx, instance, "bot", "1", "id", "secret", oauth2.OOB, "read write"))
+	require.NoError(t, app.SaveToken(ctx, instance, "bot", app.Token{
+		AccessToken:  "stale",
+		RefreshToken: "refresh",
+		Scopes:       "read write",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}))
+
+	c, err := NewClient(ctx, instance, "bot")
+	require.NoError(t, err)
+	assert.Equal(t, "stale", c.Token)
+	info, err := app.Get(ctx, instance, "bot")
+	require.NoError(t, err)
+	assert.True(t, info.LastUsed.IsZero(), "not used until a request succeeds")
+
+	// rejected before it expires, e.g. after being revoked
+	require.NoError(t, c.DeleteStatus(ctx, "1"))
+	assert.Equal(t, "fresh", c.Token)
+	info, err = app.Get(ctx, instance, "bot")
+	require.NoError(t, err)
+	assert.False(t, info.LastUsed.IsZero())
+
+	token, err := app.GetToken(ctx, instance, "bot")
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", token.AccessToken)
+	assert.Equal(t, "refresh", token.RefreshToken)
+}
+
+func TestErrorMessage(t *testing.T) {
+	assert.Equal(t, "got status 422: Validation failed: Text can't be blank",
+		newError(422, []byte(`{"error":"Validation failed: Text can't be blank"}`)).Error())
+	assert.Equal(t, "got status 502: Bad Gateway", newError(502, nil).Error())
+	assert.Equal(t, "got status 500: oops", newError(500, []byte("oops\n")).Error())
+}
+
+func TestUploadMedia(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/media", r.URL.Path)
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "a picture", r.FormValue("description"))
+
+		f, _, err := r.FormFile("file")
+		require.NoError(t, err)
+		defer f.Close()
+		file, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, "large", string(file))
+
+		th, _, err := r.FormFile("thumbnail")
+		require.NoError(t, err)
+		defer th.Close()
+		thumbnail, err := io.ReadAll(th)
+		require.NoError(t, err)
+		assert.Equal(t, "small", string(thumbnail))
+
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"id":"22348641"}`)
+	}))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL}
+	id, err := c.UploadMedia(context.Background(), MediaUpload{
+		ContentType: ContentTypeMediaJPEG,
+		File:        []byte("large"),
+		Thumbnail:   []byte("small"),
+		Description: "a picture",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "22348641", id)
+}
+
+func TestAccountStatuses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/accounts/42/statuses", r.URL.Path)
+		assert.Equal(t, "5", r.URL.Query().Get("limit"))
+		assert.Equal(t, "true", r.URL.Query().Get("exclude_replies"))
+		assert.False(t, r.URL.Query().Has("max_id"))
+		_, _ = fmt.Fprint(w, `[{"id":"2","visibility":"public"},{"id":"1","visibility":"private"}]`)
+	}))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL}
+	statuses, err := c.AccountStatuses(context.Background(), "42", ListStatuses{Limit: 5, ExcludeReplies: true})
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "2", statuses[0].ID)
+	assert.Equal(t, VisibilityPrivate, statuses[1].Visibility)
+}
+
+func TestVerifyCredentialsAccount(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/accounts/verify_credentials", r.URL.Path)
+		_, _ = fmt.Fprint(w, `{"id":"1","username":"bot","acct":"bot"}`)
+	}))
+	defer srv.Close()
+	transport := http.DefaultTransport
+	http.DefaultTransport = srv.Client().Transport
+	defer func() { http.DefaultTransport = transport }()
+
+	instance := srv.Listener.Addr().String()
+	ctx := app.Set(context.Background(), app.NewMemoryStore())
+	require.NoError(t, app.Register(ctx, instance, "app", "1", "id", "secret", oauth2.OOB, "read"))
+
+	for _, acct := range []string{"bot", "other"} {
+		ctx := app.SetAccount(ctx, acct)
+		require.NoError(t, app.SaveToken(ctx, instance, "app", app.Token{AccessToken: acct, Scopes: "read"}))
+		c, err := NewClient(ctx, instance, "app")
+		require.NoError(t, err)
+
+		_, err = c.VerifyCredentials(ctx)
+		if acct == "other" {
+			assert.ErrorIs(t, err, ErrWrongAccount)
+			continue
+		}
+		require.NoError(t, err)
+	}
+
+	accounts, err := app.ListAccounts(ctx, instance, "app")
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+	assert.Equal(t, "1", accounts[0].AccountID, "stored for the account the token belongs to")
+	assert.Empty(t, accounts[1].AccountID)
+}
+
+func TestRetry(t *testing.T) {
+	reset := time.Now().Add(10 * time.Minute).UTC().Truncate(time.Second)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Limit", "30")
+		w.Header().Set("X-RateLimit-Reset", reset.Format(time.RFC3339))
+		switch requests {
+		case 1:
+			w.Header().Set("X-RateLimit-Remaining", "2")
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("X-RateLimit-Remaining", "1")
+			w.WriteHeader(http.StatusOK)
+		case 3:
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Header().Set("X-RateLimit-Remaining", "29")
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	var waits []time.Duration
+	c := &Client{
+		BaseURL: srv.URL,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		},
+	}
+
+	require.NoError(t, c.DeleteStatus(context.Background(), "1"))
+	require.Len(t, waits, 1, "5xx is retried after a backoff")
+	assert.GreaterOrEqual(t, waits[0], initialBackoff/2)
+	assert.LessOrEqual(t, waits[0], initialBackoff)
+	assert.Equal(t, RateLimit{Limit: 30, Remaining: 1, Reset: reset}, c.RateLimits[RateLimitDeleteStatus])
+
+	waits = nil
+	require.NoError(t, c.DeleteStatus(context.Background(), "2"))
+	require.Len(t, waits, 1, "429 waits for the reset")
+	assert.InDelta(t, time.Until(reset)+resetMargin, waits[0], float64(time.Second))
+	assert.Equal(t, 29, c.RateLimits[RateLimitDeleteStatus].Remaining)
+	assert.Equal(t, 4, requests)
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := &Client{
+		BaseURL: srv.URL,
+		sleep:   func(ctx context.Context, d time.Duration) error { return nil },
+	}
+	err := c.DeleteStatus(context.Background(), "1")
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	assert.Equal(t, maxRetries+1, requests)
+}
+
+func TestRetryPost(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests%2 == 1 {
+			// the instance may have posted the status behind this
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"id":"1"}`)
+	}))
+	defer srv.Close()
+
+	c := &Client{
+		BaseURL: srv.URL,
+		sleep:   func(ctx context.Context, d time.Duration) error { return nil },
+	}
+
+	_, err := c.SubmitStatus(context.Background(), Status{Text: "hi"})
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+	assert.Equal(t, 1, requests, "not sent again without an idempotency key")
+
+	requests = 0
+	id, err := c.SubmitStatus(context.Background(), Status{Text: "hi", IdempotencyKey: IdempotencyKey("bot", "1")})
+	require.NoError(t, err)
+	assert.Equal(t, "1", id)
+	assert.Equal(t, 2, requests)
+}
+
+func TestRateLimitDeadline(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	c := &Client{
+		BaseURL: srv.URL,
+		RateLimits: map[RateLimitFamily]RateLimit{
+			RateLimitGlobal: {Limit: 300, Remaining: 0, Reset: time.Now().Add(5 * time.Minute)},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	err := c.DeleteStatus(ctx, "1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, requests, "fails before waiting")
+}
+
+func TestRateLimitFamilies(t *testing.T) {
+	reset := time.Now().Add(30 * time.Minute).UTC().Truncate(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.Header().Set("X-RateLimit-Limit", "30")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", reset.Format(time.RFC3339))
+			return
+		}
+		w.Header().Set("X-RateLimit-Limit", "300")
+		w.Header().Set("X-RateLimit-Remaining", "299")
+		w.Header().Set("X-RateLimit-Reset", time.Now().Add(5*time.Minute).UTC().Format(time.RFC3339))
+		_, _ = fmt.Fprint(w, `[]`)
+	}))
+	defer srv.Close()
+
+	var waits []time.Duration
+	c := &Client{
+		BaseURL: srv.URL,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		},
+	}
+
+	require.NoError(t, c.DeleteStatus(context.Background(), "1"))
+	assert.True(t, c.RateLimits[RateLimitDeleteStatus].exhausted(time.Now()))
+	assert.Empty(t, waits)
+
+	_, err := c.AccountStatuses(context.Background(), "42", ListStatuses{})
+	require.NoError(t, err)
+	assert.Empty(t, waits, "other requests are not held up by deleting")
+	assert.Equal(t, 299, c.RateLimits[RateLimitGlobal].Remaining)
+	assert.Equal(t, 0, c.RateLimits[RateLimitDeleteStatus].Remaining, "kept apart from the global limit")
+
+	require.NoError(t, c.DeleteStatus(context.Background(), "2"))
+	require.Len(t, waits, 1, "deleting waits for its own reset")
+	assert.InDelta(t, time.Until(reset)+resetMargin, waits[0], float64(time.Second))
+}
+
+func TestPoll(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, []string{"yes", "no"}, r.PostForm["poll[options][]"])
+			assert.Equal(t, "3600", r.PostForm.Get("poll[expires_in]"))
+			assert.Equal(t, "true", r.PostForm.Get("poll[multiple]"))
+			assert.False(t, r.PostForm.Has("poll[hide_totals]"))
+			_, _ = fmt.Fprint(w, `{"id":"1"}`)
+		case http.MethodGet:
+			assert.Equal(t, "/api/v1/statuses/1", r.URL.Path)
+			_, _ = fmt.Fprint(w, `{"id":"1","poll":{"id":"34830","expires_at":"2026-10-17T12:00:00.000Z","expired":true,
+				"multiple":true,"votes_count":10,"voters_count":6,
+				"options":[{"title":"yes","votes_count":7},{"title":"no","votes_count":3}]}}`)
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL}
+	_, err := c.SubmitStatus(context.Background(), Status{
+		Text:       "ok?",
+		Visibility: VisibilityPublic,
+		Poll:       &Poll{Options: []string{"yes", "no"}, ExpiresIn: time.Hour, Multiple: true},
+	})
+	require.NoError(t, err)
+
+	poll, err := c.StatusPoll(context.Background(), "1")
+	require.NoError(t, err)
+	assert.True(t, poll.Expired)
+	assert.Equal(t, 10, poll.VotesCount)
+	require.NotNil(t, poll.VotersCount)
+	assert.Equal(t, 6, *poll.VotersCount)
+	require.Len(t, poll.Options, 2)
+	assert.Equal(t, "yes", poll.Options[0].Title)
+	require.NotNil(t, poll.Options[0].VotesCount)
+	assert.Equal(t, 7, *poll.Options[0].VotesCount)
+}
+
+func TestValidatePoll(t *testing.T) {
+	limits := discovery.Defaults()
+	p := Poll{Options: []string{"yes", "no"}, ExpiresIn: 24 * time.Hour}
+	assert.NoError(t, Status{Text: "ok?", Poll: &p}.Validate(limits))
+	assert.Error(t, Status{Text: "ok?", Poll: &p, MediaIDs: []string{"1"}}.Validate(limits))
+
+	assert.Error(t, Poll{Options: []string{"yes"}, ExpiresIn: time.Hour}.Validate(limits))
+	assert.Error(t, Poll{Options: []string{"a", "b", "c", "d", "e"}, ExpiresIn: time.Hour}.Validate(limits))
+	assert.Error(t, Poll{Options: []string{"yes", "no"}, ExpiresIn: time.Minute}.Validate(limits))
+	assert.Error(t, Poll{Options: []string{"yes", strings.Repeat("n", 51)}, ExpiresIn: time.Hour}.Validate(limits))
+}
+
+func TestScheduledStatuses(t *testing.T) {
+	at := time.Date(2026, 10, 31, 18, 0, 0, 0, time.UTC)
+	ignoreSchedule := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/statuses":
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "2026-10-31T18:00:00Z", r.PostForm.Get("scheduled_at"))
+			if ignoreSchedule {
+				_, _ = fmt.Fprint(w, `{"id":"103254962155278888","created_at":"2026-10-17T12:00:00.000Z"}`)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"id":"3221","scheduled_at":"2026-10-31T18:00:00.000Z","params":{"text":"boo"}}`)
+		case r.Method == http.MethodGet:
+			switch r.URL.Query().Get("max_id") {
+			case "":
+				_, _ = fmt.Fprint(w, `[{"id":"3222","scheduled_at":"2026-11-01T18:00:00.000Z","params":{"text":"hi","visibility":"public"}},
+					{"id":"3221","scheduled_at":"2026-10-31T18:00:00.000Z","params":{"text":"boo","visibility":null,"poll":{"options":["a","b"]}}}]`)
+			case "3221":
+				_, _ = fmt.Fprint(w, `[]`)
+			default:
+				t.Errorf("unexpected max_id %q", r.URL.Query().Get("max_id"))
+			}
+		case r.Method == http.MethodPut:
+			assert.Equal(t, "/api/v1/scheduled_statuses/3221", r.URL.Path)
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "2026-11-02T09:30:00Z", r.PostForm.Get("scheduled_at"))
+			_, _ = fmt.Fprint(w, `{"id":"3221","scheduled_at":"2026-11-02T09:30:00.000Z","params":{"text":"boo"}}`)
+		case r.Method == http.MethodDelete:
+			assert.Equal(t, "/api/v1/scheduled_statuses/3221", r.URL.Path)
+			_, _ = fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL}
+	id, err := c.SubmitStatus(context.Background(), Status{Text: "boo", ScheduledAt: at})
+	require.NoError(t, err)
+	assert.Equal(t, "3221", id)
+
+	ignoreSchedule = true
+	id, err = c.SubmitStatus(context.Background(), Status{Text: "boo", ScheduledAt: at})
+	assert.ErrorIs(t, err, ErrNotScheduled)
+	assert.Equal(t, "103254962155278888", id)
+
+	statuses, err := c.ScheduledStatuses(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, VisibilityPublic, statuses[0].Params.Visibility)
+	assert.True(t, at.Equal(statuses[1].ScheduledAt))
+	require.NotNil(t, statuses[1].Params.Poll)
+	assert.Nil(t, statuses[0].Params.Poll)
+
+	rescheduled, err := c.RescheduleStatus(context.Background(), "3221", time.Date(2026, 11, 2, 10, 30, 0, 0, time.FixedZone("CET", 3600)))
+	require.NoError(t, err)
+	assert.Equal(t, "2026-11-02T09:30:00Z", rescheduled.ScheduledAt.Format(time.RFC3339))
+
+	require.NoError(t, c.CancelScheduledStatus(context.Background(), "3221"))
+
+	limits := discovery.Defaults()
+	assert.Error(t, Status{Text: "boo", ScheduledAt: time.Now().Add(time.Minute)}.Validate(limits), "too soon")
+	assert.NoError(t, Status{Text: "boo", ScheduledAt: time.Now().Add(time.Hour)}.Validate(limits))
+}
@@ -3,14 +3,11 @@ package toot
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
-
-	"github.com/quells/mastobot/internal/app"
 )
 
 type ContentTypeMedia string
@@ -43,7 +40,7 @@ func (m MediaUpload) formatBody() (encoded []byte, contentType string, err error
 		if err != nil {
 			return
 		}
-		_, err = wi.Write(m.Thumbnail)
+		_, err = wi.Write(m.File)
 		if err != nil {
 			return
 		}
@@ -90,15 +87,8 @@ type mediaUploadResponse struct {
 	ID string `json:"id"`
 }
 
-func (m MediaUpload) Submit(ctx context.Context, instance, appName string) (mediaID string, err error) {
-	var accessToken string
-	accessToken, err = app.GetAccessToken(ctx, instance, appName)
-	if err != nil {
-		return
-	}
-
-	u := fmt.Sprintf("https://%s/api/v2/media", instance)
-
+// UploadMedia to attach to a status and return its ID.
+func (c *Client) UploadMedia(ctx context.Context, m MediaUpload) (mediaID string, err error) {
 	var reqBody []byte
 	var contentType string
 	reqBody, contentType, err = m.formatBody()
@@ -106,41 +96,12 @@ func (m MediaUpload) Submit(ctx context.Context, instance, appName string) (medi
 		return
 	}
 
-	var req *http.Request
-	req, err = http.NewRequest(http.MethodPost, u, bytes.NewReader(reqBody))
-	if err != nil {
-		return
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", contentType)
-	req = req.WithContext(ctx)
-
-	var resp *http.Response
-	resp, err = http.DefaultClient.Do(req)
-	if err != nil {
-		return
-	}
-
-	var respBody []byte
-	respBody, err = io.ReadAll(resp.Body)
-	_ = resp.Body.Close()
-	if err != nil {
-		return
-	}
-
-	statusRange := resp.StatusCode / 100
-	if statusRange != 2 {
-		err = fmt.Errorf("got status code %d: %s", resp.StatusCode, string(respBody))
-		return
-	}
-
-	var uploadResp mediaUploadResponse
-	err = json.Unmarshal(respBody, &uploadResp)
+	var resp mediaUploadResponse
+	err = c.request(ctx, http.MethodPost, "/api/v2/media", nil, http.Header{"Content-Type": {contentType}}, reqBody, &resp)
 	if err != nil {
 		return
 	}
 
-	mediaID = uploadResp.ID
+	mediaID = resp.ID
 	return
 }
@@ -0,0 +1,62 @@
+package toot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Poll to attach to a status, instead of media.
+type Poll struct {
+	Options    []string
+	ExpiresIn  time.Duration // rounded down to seconds
+	Multiple   bool          // allow choosing more than one option
+	HideTotals bool          // hide vote counts until the poll ends
+}
+
+func (p Poll) setFormData(f *url.Values) {
+	SetNonZero(f, "poll[options][]", p.Options)
+	f.Set("poll[expires_in]", strconv.Itoa(int(p.ExpiresIn/time.Second)))
+	SetNonZero(f, "poll[multiple]", p.Multiple)
+	SetNonZero(f, "poll[hide_totals]", p.HideTotals)
+}
+
+// PollResults of a poll attached to a status.
+type PollResults struct {
+	ID          string       `json:"id"`
+	ExpiresAt   *time.Time   `json:"expires_at"` // nil if the poll never ends
+	Expired     bool         `json:"expired"`
+	Multiple    bool         `json:"multiple"`
+	VotesCount  int          `json:"votes_count"`
+	VotersCount *int         `json:"voters_count"` // nil unless Multiple
+	Options     []PollOption `json:"options"`
+}
+
+type PollOption struct {
+	Title      string `json:"title"`
+	VotesCount *int   `json:"votes_count"` // nil while totals are hidden
+}
+
+// ErrNoPoll is returned for statuses without a poll.
+var ErrNoPoll = errors.New("status has no poll")
+
+// StatusPoll results of the poll attached to the status.
+func (c *Client) StatusPoll(ctx context.Context, statusID string) (poll PollResults, err error) {
+	var resp struct {
+		Poll *PollResults `json:"poll"`
+	}
+	err = c.request(ctx, http.MethodGet, "/api/v1/statuses/"+url.PathEscape(statusID), nil, nil, nil, &resp)
+	if err != nil {
+		return
+	}
+	if resp.Poll == nil {
+		err = ErrNoPoll
+		return
+	}
+
+	poll = *resp.Poll
+	return
+}
@@ -0,0 +1,112 @@
+package toot
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxRetries     = 5               // of 429 and 5xx responses
+	initialBackoff = 2 * time.Second // before the first retry, doubled for each one after
+	maxBackoff     = 2 * time.Minute // between two retries
+	resetMargin    = 1 * time.Second // after the reported reset, for clock skew
+)
+
+// RateLimit reported by the instance in the X-RateLimit headers of a response.
+type RateLimit struct {
+	Limit     int       // requests allowed per period
+	Remaining int       // requests left in this period
+	Reset     time.Time // when Remaining is reset to Limit
+}
+
+// RateLimitFamily of endpoints which the instance limits together.
+type RateLimitFamily string
+
+const (
+	RateLimitGlobal       RateLimitFamily = "global"        // every request
+	RateLimitDeleteStatus RateLimitFamily = "delete_status" // deleting statuses, 30 per 30 minutes on Mastodon
+	RateLimitMedia        RateLimitFamily = "media"         // uploading media, 30 per 30 minutes on Mastodon
+)
+
+// rateLimitFamily of a request. Its response reports the family's limit, which
+// applies on top of the global one.
+func rateLimitFamily(method, path string) RateLimitFamily {
+	switch {
+	case method == http.MethodDelete && strings.HasPrefix(path, "/api/v1/statuses/"):
+		return RateLimitDeleteStatus
+	case method == http.MethodPost && (path == "/api/v1/media" || path == "/api/v2/media"):
+		return RateLimitMedia
+	default:
+		return RateLimitGlobal
+	}
+}
+
+// parseRateLimit from the headers of a response, if they are all present.
+func parseRateLimit(h http.Header) (rl RateLimit, ok bool) {
+	var err error
+	if rl.Limit, err = strconv.Atoi(h.Get("X-RateLimit-Limit")); err != nil {
+		return
+	}
+	if rl.Remaining, err = strconv.Atoi(h.Get("X-RateLimit-Remaining")); err != nil {
+		return
+	}
+	if rl.Reset, err = time.Parse(time.RFC3339, h.Get("X-RateLimit-Reset")); err != nil {
+		return
+	}
+	return rl, true
+}
+
+// exhausted reports whether no requests are left until the reset.
+func (rl RateLimit) exhausted(now time.Time) bool {
+	return rl.Limit > 0 && rl.Remaining <= 0 && rl.Reset.After(now)
+}
+
+// retryable responses are worth sending again after a while. A 429 was not
+// acted on, but a 5xx may come from a proxy after the instance acted on the
+// request, so only requests which are safe to repeat are retried after one.
+func retryable(statusCode int, method string, header http.Header) bool {
+	if statusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if statusCode/100 != 5 {
+		return false
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return header.Get("Idempotency-Key") != ""
+	}
+}
+
+// backoff before the retry following the given number of retries: exponential
+// with full jitter over its upper half.
+func backoff(retries int) time.Duration {
+	d := initialBackoff << retries
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// sleepContext for d, or fail right away if the context would be done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return fmt.Errorf("waiting %s to retry would pass the deadline: %w",
+			d.Round(time.Second), context.DeadlineExceeded)
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,62 @@
+package toot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// MinScheduleDelay is how far ahead Mastodon requires statuses to be scheduled.
+const MinScheduleDelay = 5 * time.Minute
+
+// ErrNotScheduled is returned with the ID of a status the instance posted right
+// away although ScheduledAt was set.
+var ErrNotScheduled = errors.New("instance posted the status instead of scheduling it")
+
+// ScheduledStatus waiting to be posted by the instance.
+type ScheduledStatus struct {
+	ID          string    `json:"id"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	Params      struct {
+		Text       string     `json:"text"`
+		MediaIDs   []string   `json:"media_ids"`
+		Sensitive  bool       `json:"sensitive"`
+		Spoiler    string     `json:"spoiler_text"`
+		Visibility Visibility `json:"visibility"`
+		Poll       *struct {
+			Options []string `json:"options"`
+		} `json:"poll"`
+	} `json:"params"`
+}
+
+// ScheduledStatuses of the account, all of them.
+func (c *Client) ScheduledStatuses(ctx context.Context) (statuses []ScheduledStatus, err error) {
+	q := url.Values{"limit": {"40"}}
+	for {
+		var page []ScheduledStatus
+		err = c.request(ctx, http.MethodGet, "/api/v1/scheduled_statuses", q, nil, nil, &page)
+		if err != nil {
+			return
+		}
+		if len(page) == 0 {
+			return
+		}
+		statuses = append(statuses, page...)
+		q.Set("max_id", page[len(page)-1].ID)
+	}
+}
+
+// RescheduleStatus to be posted at another time.
+func (c *Client) RescheduleStatus(ctx context.Context, scheduledID string, at time.Time) (status ScheduledStatus, err error) {
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	body := url.Values{"scheduled_at": {at.UTC().Format(time.RFC3339)}}.Encode()
+	err = c.request(ctx, http.MethodPut, "/api/v1/scheduled_statuses/"+url.PathEscape(scheduledID), nil, header, []byte(body), &status)
+	return
+}
+
+// CancelScheduledStatus so it is never posted.
+func (c *Client) CancelScheduledStatus(ctx context.Context, scheduledID string) error {
+	return c.request(ctx, http.MethodDelete, "/api/v1/scheduled_statuses/"+url.PathEscape(scheduledID), nil, nil, nil, nil)
+}
@@ -3,15 +3,13 @@ package toot
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
-
-	"github.com/quells/mastobot/internal/app"
 )
 
 type Visibility int
@@ -82,6 +80,16 @@ func (v *Visibility) UnmarshalJSON(data []byte) error {
 	return fmt.Errorf("data is not a valid Visibility value")
 }
 
+// ContentTypeText of a status' text. Only Pleroma and Akkoma accept anything but
+// plain text; other instances post the text as is.
+type ContentTypeText string
+
+const (
+	ContentTypePlain    ContentTypeText = "text/plain"
+	ContentTypeMarkdown ContentTypeText = "text/markdown"
+	ContentTypeHTML     ContentTypeText = "text/html"
+)
+
 type Status struct {
 	ID         string     `json:"id"`
 	Text       string     `json:"text"`
@@ -90,8 +98,19 @@ type Status struct {
 	Sensitive  bool       `json:"sensitive"`
 	Spoiler    string     `json:"spoiler_text"`
 	Visibility Visibility `json:"visibility"`
+	Language   string     `json:"language"` // ISO 639 code, detected by the instance if empty
+	Poll       *Poll      `json:"-"`        // to submit; see Client.StatusPoll for results
+
+	ContentType ContentTypeText `json:"-"` // plain text if empty
+
+	// ScheduledAt posts the status at this time instead of right away.
+	ScheduledAt time.Time `json:"-"`
 
 	CreatedAt time.Time `json:"created_at"`
+
+	// IdempotencyKey makes the instance return the status already submitted
+	// with the same key, for about an hour, instead of posting it again.
+	IdempotencyKey string `json:"-"`
 }
 
 func (s Status) FormData() url.Values {
@@ -103,85 +122,57 @@ func (s Status) FormData() url.Values {
 	SetNonZero(&f, "in_reply_to_id", s.ReplyToID)
 	SetNonZero(&f, "sensitive", s.Sensitive)
 	SetNonZero(&f, "spoiler_text", s.Spoiler)
+	SetNonZero(&f, "language", s.Language)
+	SetNonZero(&f, "content_type", string(s.ContentType))
+	if s.Poll != nil {
+		s.Poll.setFormData(&f)
+	}
+	if !s.ScheduledAt.IsZero() {
+		f.Set("scheduled_at", s.ScheduledAt.UTC().Format(time.RFC3339))
+	}
 	return f
 }
 
+// statusResponse is a Status, or a ScheduledStatus if scheduled_at was set.
 type statusResponse struct {
-	ID    string `json:"id"`
-	Error string `json:"error,omitempty"`
+	ID          string     `json:"id"`
+	ScheduledAt *time.Time `json:"scheduled_at"`
 }
 
-func (s Status) Submit(ctx context.Context, instance, appName string) (tootID string, err error) {
-	var accessToken string
-	accessToken, err = app.GetAccessToken(ctx, instance, appName)
-	if err != nil {
-		return
+// IdempotencyKey derived from parts which identify a status, e.g. the
+// application name and the data it reports.
+func IdempotencyKey(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		_, _ = h.Write([]byte(p))
+		_, _ = h.Write([]byte{0})
 	}
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-	u := fmt.Sprintf("https://%s/api/v1/statuses", instance)
-	f := s.FormData()
-
-	var req *http.Request
-	req, err = http.NewRequest(http.MethodPost, u, strings.NewReader(f.Encode()))
-	if err != nil {
-		return
+// SubmitStatus and return its ID, or the ID of the ScheduledStatus if
+// ScheduledAt is set. Retrying a status with an IdempotencyKey does not post it
+// twice.
+func (c *Client) SubmitStatus(ctx context.Context, s Status) (statusID string, err error) {
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	if s.IdempotencyKey != "" {
+		header.Set("Idempotency-Key", s.IdempotencyKey)
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	var resp *http.Response
-	resp, err = http.DefaultClient.Do(req)
+	var resp statusResponse
+	err = c.request(ctx, http.MethodPost, "/api/v1/statuses", nil, header, []byte(s.FormData().Encode()), &resp)
 	if err != nil {
 		return
 	}
 
-	var respBody []byte
-	respBody, err = io.ReadAll(resp.Body)
-	_ = resp.Body.Close()
-	if err != nil {
-		return
+	statusID = resp.ID
+	if !s.ScheduledAt.IsZero() && resp.ScheduledAt == nil {
+		err = ErrNotScheduled
 	}
-
-	var response statusResponse
-	err = json.Unmarshal(respBody, &response)
-	if err != nil {
-		err = fmt.Errorf("got status %d: %s %w", resp.StatusCode, string(respBody), err)
-		return
-	}
-	if response.Error != "" {
-		err = fmt.Errorf("got status %d: %s", resp.StatusCode, response.Error)
-		return
-	}
-
-	tootID = response.ID
 	return
 }
 
-func Delete(ctx context.Context, instance, appName, statusID string) (err error) {
-	var accessToken string
-	accessToken, err = app.GetAccessToken(ctx, instance, appName)
-	if err != nil {
-		return
-	}
-
-	u := fmt.Sprintf("https://%s/api/v1/statuses/%s", instance, statusID)
-
-	var req *http.Request
-	req, err = http.NewRequest(http.MethodDelete, u, nil)
-	if err != nil {
-		return
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
-
-	var resp *http.Response
-	resp, err = http.DefaultClient.Do(req)
-	if err != nil {
-		return
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("got status %d", resp.StatusCode)
-	}
-	return nil
+// DeleteStatus by ID.
+func (c *Client) DeleteStatus(ctx context.Context, statusID string) error {
+	return c.request(ctx, http.MethodDelete, "/api/v1/statuses/"+url.PathEscape(statusID), nil, nil, nil, nil)
 }
@@ -0,0 +1,95 @@
+package toot
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	"github.com/quells/mastobot/internal/discovery"
+)
+
+// urlLength is how many characters a link counts as, regardless of its length.
+const urlLength = 23
+
+var urlPattern = regexp.MustCompile(`https?://\S+`)
+
+// languagePattern of ISO 639-1 and 639-3 codes, optionally with a region as in
+// zh-TW.
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// CountCharacters the way Mastodon does when enforcing the status length limit.
+func CountCharacters(text string) int {
+	n := utf8.RuneCountInString(text)
+	for _, u := range urlPattern.FindAllString(text, -1) {
+		n += urlLength - utf8.RuneCountInString(u)
+	}
+	return n
+}
+
+// Truncate text to at most max characters, ending with an ellipsis if it was
+// shortened.
+func Truncate(text string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:max-1]) + "…"
+}
+
+// Validate the status against the instance's limits before submitting it.
+func (s Status) Validate(limits discovery.Instance) error {
+	if n := CountCharacters(s.Text) + CountCharacters(s.Spoiler); n > limits.MaxCharacters {
+		return fmt.Errorf("status has %d characters, instance allows %d", n, limits.MaxCharacters)
+	}
+	if n := len(s.MediaIDs); n > limits.MaxMediaAttachments {
+		return fmt.Errorf("status has %d media attachments, instance allows %d", n, limits.MaxMediaAttachments)
+	}
+	if s.Language != "" && !languagePattern.MatchString(s.Language) {
+		return fmt.Errorf("language %q is not an ISO 639 code, e.g. en", s.Language)
+	}
+	switch s.ContentType {
+	case "", ContentTypePlain, ContentTypeMarkdown, ContentTypeHTML:
+	default:
+		return fmt.Errorf("content type %q is not one of %s, %s or %s", s.ContentType, ContentTypePlain, ContentTypeMarkdown, ContentTypeHTML)
+	}
+	if !s.ScheduledAt.IsZero() && time.Until(s.ScheduledAt) < MinScheduleDelay {
+		return fmt.Errorf("status must be scheduled at least %s ahead", MinScheduleDelay)
+	}
+	if s.Poll != nil {
+		if len(s.MediaIDs) > 0 {
+			return fmt.Errorf("status cannot have both media attachments and a poll")
+		}
+		return s.Poll.Validate(limits)
+	}
+	return nil
+}
+
+// Validate the poll against the instance's limits before submitting it.
+func (p Poll) Validate(limits discovery.Instance) error {
+	if n := len(p.Options); n < 2 || n > limits.MaxPollOptions {
+		return fmt.Errorf("poll has %d options, instance allows 2 to %d", n, limits.MaxPollOptions)
+	}
+	for _, o := range p.Options {
+		if n := utf8.RuneCountInString(o); n > limits.MaxPollOptionChars {
+			return fmt.Errorf("poll option %q has %d characters, instance allows %d", o, n, limits.MaxPollOptionChars)
+		}
+	}
+	min := time.Duration(limits.MinPollExpiration) * time.Second
+	max := time.Duration(limits.MaxPollExpiration) * time.Second
+	if p.ExpiresIn < min || p.ExpiresIn > max {
+		return fmt.Errorf("poll expires in %s, instance allows %s to %s", p.ExpiresIn, min, max)
+	}
+	return nil
+}
+
+// Validate the upload against the instance's limits before submitting it.
+func (m MediaUpload) Validate(limits discovery.Instance) error {
+	if !limits.SupportsMIMEType(string(m.ContentType)) {
+		return fmt.Errorf("instance does not support %s uploads", m.ContentType)
+	}
+	if n := int64(len(m.File)); n > limits.ImageSizeLimit {
+		return fmt.Errorf("image is %d bytes, instance allows %d", n, limits.ImageSizeLimit)
+	}
+	return nil
+}